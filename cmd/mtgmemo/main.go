@@ -20,6 +20,7 @@ var (
 	decodeFlag            = flag.String("d", "", "decode")
 	decodeOmitMmsigFlag   = flag.Bool("om", false, "decode omit mmsig")
 	decodeParamsTypesFlag = flag.String("pts", "", "decode params types, example: [\"decimal\", \"uuid\", false, 0, \"int8\"]")
+	decodeTraceFlag       = flag.Bool("t", false, "print an annotated hexdump of the decoded memo")
 
 	encodeFlag       = flag.String("e", "", "encode")
 	encodeBase64Flag = flag.String("b64", "std", "base64 method, std or url")
@@ -39,6 +40,8 @@ func main() {
 		err    error
 	)
 	switch {
+	case *decodeFlag != "" && *decodeTraceFlag:
+		result, err = Trace(*decodeFlag, *decodeOmitMmsigFlag, *decodeParamsTypesFlag)
 	case *decodeFlag != "":
 		result, err = Decode(*decodeFlag, *decodeOmitMmsigFlag, *decodeParamsTypesFlag)
 	case *encodeFlag != "":
@@ -49,6 +52,10 @@ func main() {
 	}
 
 	if err != nil {
+		// the trace of a malformed memo is printed along with the error
+		if result != "" {
+			fmt.Println(result)
+		}
 		log.Fatalln(err)
 	}
 	fmt.Println(result)
@@ -65,21 +72,57 @@ func Decode(v string, omitMmsig bool, paramsTypes string) (string, error) {
 	return string(data), nil
 }
 
+// Trace decodes the memo like Decode and returns an annotated hexdump of the
+// bytes read as the header, the mmsig and each param. The hexdump is returned
+// with the error if the memo is malformed.
+func Trace(v string, omitMmsig bool, paramsTypes string) (string, error) {
+	data, withChecksum, err := parseMemo(v)
+	if err != nil {
+		return "", err
+	}
+
+	dec, trace := mtgpack.NewTraceDecoder(data)
+	_, err = decodeData(dec, withChecksum, omitMmsig, paramsTypes)
+
+	var sb strings.Builder
+	if err := trace.Dump(&sb, data); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(sb.String(), "\n"), err
+}
+
 func decode(ds string, omitMmsig bool, paramsTypesStr string) (*EncodeData, error) {
+	data, withChecksum, err := parseMemo(ds)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeData(mtgpack.NewDecoder(data), withChecksum, omitMmsig, paramsTypesStr)
+}
+
+// parseMemo decodes a base64 memo, in URL or standard encoding, and strips its
+// checksum if it has one.
+func parseMemo(ds string) ([]byte, bool, error) {
 	data, err := base64.URLEncoding.DecodeString(ds)
 	if err != nil {
 		data, err = base64.StdEncoding.DecodeString(ds)
 		if err != nil {
-			return nil, fmt.Errorf("base64 decode memo failed: %v", err)
+			return nil, false, fmt.Errorf("base64 decode memo failed: %v", err)
 		}
 	}
 
 	data, withChecksum := checksum.Sha256Verify(data)
-	dec := mtgpack.NewDecoder(data)
+	return data, withChecksum, nil
+}
+
+func decodeData(dec *mtgpack.Decoder, withChecksum, omitMmsig bool, paramsTypesStr string) (*EncodeData, error) {
 	result := &EncodeData{}
+	dec.EnterField("Header")
 	if err := dec.DecodeValue(&result.Header); err != nil {
 		return nil, fmt.Errorf("decode header failed: %v", err)
 	}
+	dec.Exit()
 
 	if (withChecksum && result.Header.Version < 2) || (!withChecksum && result.Header.Version != 1) {
 		return nil, fmt.Errorf("invalid version: %d, checksum: %v", result.Header.Version, withChecksum)
@@ -87,9 +130,11 @@ func decode(ds string, omitMmsig bool, paramsTypesStr string) (*EncodeData, erro
 
 	if !omitMmsig {
 		result.Mmsig = &protocol.MultisigReceiver{}
+		dec.EnterField("Mmsig")
 		if err := dec.DecodeValue(result.Mmsig); err != nil {
 			return nil, fmt.Errorf("decode mmsig failed: %v", err)
 		}
+		dec.Exit()
 	}
 
 	if paramsTypesStr != "" {
@@ -98,7 +143,8 @@ func decode(ds string, omitMmsig bool, paramsTypesStr string) (*EncodeData, erro
 			return nil, fmt.Errorf("decode params types failed: %v", err)
 		}
 
-		for _, param := range paramsTypes {
+		dec.EnterField("Params")
+		for i, param := range paramsTypes {
 			var (
 				decodeValue any
 				prFunc      func() any
@@ -162,12 +208,15 @@ func decode(ds string, omitMmsig bool, paramsTypesStr string) (*EncodeData, erro
 				prFunc = func() any { return param }
 			}
 
+			dec.EnterIndex(i)
 			if err := dec.DecodeValue(decodeValue); err != nil {
 				return nil, fmt.Errorf("decode param failed: %v, param: %v", err, param)
 			}
+			dec.Exit()
 
 			result.Params = append(result.Params, prFunc())
 		}
+		dec.Exit()
 	}
 
 	return result, nil
@@ -2,6 +2,7 @@ package main
 
 import (
 	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -152,3 +153,30 @@ func TestEncode(t *testing.T) {
 		})
 	}
 }
+
+func TestTrace(t *testing.T) {
+	got, err := Trace("AQQBs7TAnCQhQey41L3t-71YsQABAAAAAQE=", true, `["int32","uint8"]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"00000000  01                                                 Header.Version: uint8 = 1",
+		"00000003  b3 b4 c0 9c 24 21 41 ec b8 d4 bd ed fb bd 58 b1      Header.FollowID: uuid.UUID = b3b4c09c-2421-41ec-b8d4-bdedfbbd58b1",
+		"00000019  01                                                 Params[1]: uint8 = 1",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Trace() == %q, want it to contain %q", got, want)
+		}
+	}
+
+	// the trace of a malformed memo is returned with the error
+	got, err = Trace("AQQBs7TAnCQhQey41L3t-71YsQABAAAAAQE=", true, `["int32","uint8","uuid"]`)
+	if err == nil {
+		t.Error("Trace() of a truncated memo succeeded")
+	}
+
+	if !strings.Contains(got, "Params[1]: uint8 = 1") {
+		t.Errorf("Trace() == %q, want the params read before the error", got)
+	}
+}
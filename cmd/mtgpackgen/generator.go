@@ -0,0 +1,1229 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pandodao/mtg/mtgpack"
+)
+
+const mtgpackPath = "github.com/pandodao/mtg/mtgpack"
+
+// kind is the kind of encoding of a type.
+type kind int
+
+const (
+	kindInt kind = iota
+	kindUint
+	kindFloat
+	kindBool
+	kindString
+	kindBytes     // []byte
+	kindByteArray // [N]byte
+	kindUUID
+	kindDecimal
+	kindTime
+	kindBigInt
+	kindSlice
+	kindArray
+	kindMap
+	kindPointer
+	kindStruct    // a struct declared in the package
+	kindInterface // an interface declared in the package, see mtgpack.RegisterUnion
+	kindExternal  // a type declared in another package
+)
+
+// typeInfo describes how a type is encoded.
+type typeInfo struct {
+	kind kind
+	expr string // Go expression of the type
+	wire string // basic type of numbers, bools and strings, like "uint16"
+	len  string // length of arrays
+
+	elem *typeInfo // element type of pointers, slices, arrays and maps
+	key  *typeInfo // key type of maps
+
+	encoder bool // has an EncodeMtg method
+	decoder bool // has a DecodeMtg method
+	binary  bool // has MarshalBinary and UnmarshalBinary methods, see mtgpack.EncodeValue
+	text    bool // has a MarshalText method
+	isZero  bool // has an IsZero method with a value receiver
+}
+
+// basicTypes maps predeclared type names to their encodings.
+var basicTypes = map[string]typeInfo{
+	"int":     {kind: kindInt, wire: "int64"},
+	"int8":    {kind: kindInt, wire: "int8"},
+	"int16":   {kind: kindInt, wire: "int16"},
+	"int32":   {kind: kindInt, wire: "int32"},
+	"rune":    {kind: kindInt, wire: "int32"},
+	"int64":   {kind: kindInt, wire: "int64"},
+	"uint":    {kind: kindUint, wire: "uint64"},
+	"uint8":   {kind: kindUint, wire: "uint8"},
+	"byte":    {kind: kindUint, wire: "uint8"},
+	"uint16":  {kind: kindUint, wire: "uint16"},
+	"uint32":  {kind: kindUint, wire: "uint32"},
+	"uint64":  {kind: kindUint, wire: "uint64"},
+	"float32": {kind: kindFloat, wire: "float32"},
+	"float64": {kind: kindFloat, wire: "float64"},
+	"bool":    {kind: kindBool, wire: "bool"},
+	"string":  {kind: kindString, wire: "string"},
+}
+
+// fieldTag holds the options parsed from the `mtg` tag of a struct field, see
+// the fieldTag type of the mtgpack package for their meaning.
+type fieldTag struct {
+	skip     bool
+	typ      string // wire type override, like "uint8"
+	len      string // length prefix, like "mtgpack.LenUint16", "0" if not set
+	optional bool
+	varint   bool
+	prec     string // decimal precision, like "18", empty if not set
+	big      bool
+	unit     string // time unit, like "mtgpack.TimeUnix", empty if not set
+	utc      bool
+	text     bool
+}
+
+// timeUnits maps the time options to mtgpack constants.
+var timeUnits = map[string]string{
+	"unixnano":  "mtgpack.TimeUnixNano",
+	"unixmilli": "mtgpack.TimeUnixMilli",
+	"unix":      "mtgpack.TimeUnix",
+}
+
+// lenPrefixes maps the names accepted by the len option to mtgpack constants.
+var lenPrefixes = map[string]string{
+	"uint8":   "mtgpack.LenUint8",
+	"uint16":  "mtgpack.LenUint16",
+	"uint32":  "mtgpack.LenUint32",
+	"uvarint": "mtgpack.LenUvarint",
+}
+
+// parseTag parses the `mtg` tag of a field with the given type, rejecting the
+// same tags as the mtgpack package.
+func parseTag(tag string, t *typeInfo) (fieldTag, error) {
+	ft := fieldTag{len: "0"}
+	if tag == "-" {
+		ft.skip = true
+		return ft, nil
+	}
+
+	if t.kind == kindPointer {
+		t = t.elem
+	}
+
+	// times are encoded as integers too
+	isInt := t.kind == kindInt || t.kind == kindUint || t.kind == kindTime
+
+	name, opts, _ := strings.Cut(tag, ",")
+	if name != "" {
+		if b, ok := basicTypes[name]; !ok || name != b.wire || (b.kind != kindInt && b.kind != kindUint) {
+			return ft, fmt.Errorf("unknown type %q", name)
+		}
+
+		if !isInt {
+			return ft, fmt.Errorf("type %q cannot be applied to %s", name, t.expr)
+		}
+
+		ft.typ = name
+	}
+
+	if opts == "" {
+		return ft, nil
+	}
+
+	for _, opt := range strings.Split(opts, ",") {
+		key, value, _ := strings.Cut(opt, "=")
+		switch key {
+		case "len":
+			p, ok := lenPrefixes[value]
+			if !ok {
+				return ft, fmt.Errorf("unknown length prefix %q", value)
+			}
+
+			ft.len = p
+		case "optional":
+			ft.optional = true
+		case "varint":
+			if !isInt {
+				return ft, fmt.Errorf("option %q cannot be applied to %s", opt, t.expr)
+			}
+
+			ft.varint = true
+		case "prec":
+			prec, err := strconv.ParseInt(value, 10, 32)
+			if err != nil || prec < 0 || prec > int64(mtgpack.MaxDecimalPrecision) {
+				return ft, fmt.Errorf("invalid decimal precision %q", value)
+			}
+
+			if t.kind != kindDecimal {
+				return ft, fmt.Errorf("option %q cannot be applied to %s", opt, t.expr)
+			}
+
+			ft.prec = strconv.FormatInt(prec, 10)
+		case "big":
+			if t.kind != kindDecimal {
+				return ft, fmt.Errorf("option %q cannot be applied to %s", opt, t.expr)
+			}
+
+			ft.big = true
+		case "text":
+			switch t.kind {
+			case kindUUID, kindDecimal, kindTime, kindBigInt, kindExternal:
+			default:
+				if !t.text {
+					return ft, fmt.Errorf("option %q cannot be applied to %s", opt, t.expr)
+				}
+			}
+
+			ft.text = true
+		case "unix", "unixmilli", "unixnano", "utc":
+			if t.kind != kindTime {
+				return ft, fmt.Errorf("option %q cannot be applied to %s", opt, t.expr)
+			}
+
+			if key == "utc" {
+				ft.utc = true
+			} else {
+				ft.unit = timeUnits[key]
+			}
+		default:
+			return ft, fmt.Errorf("unknown option %q", opt)
+		}
+	}
+
+	if ft.prec != "" && ft.big {
+		return ft, fmt.Errorf("options %q and %q cannot be combined", "prec", "big")
+	}
+
+	// the length prefix applies to strings, slices, maps and the text or binary
+	// form of a value, types of other packages are assumed to have one
+	if ft.len != "0" && !ft.text && !isBinary(t) && t.kind != kindExternal {
+		switch t.kind {
+		case kindString, kindBytes, kindSlice, kindMap:
+		default:
+			return ft, fmt.Errorf("option %q cannot be applied to %s", "len", t.expr)
+		}
+	}
+
+	return ft, nil
+}
+
+// isBinary reports whether values of type t are encoded and decoded with their
+// MarshalBinary and UnmarshalBinary methods.
+func isBinary(t *typeInfo) bool {
+	return !t.encoder && t.binary
+}
+
+// typeDecl is a type declared in the package.
+type typeDecl struct {
+	spec    *ast.TypeSpec
+	imports map[string]string // imports of the declaring file, name to path
+	methods map[string]bool   // methods of the type, to whether they have a pointer receiver
+}
+
+// field is an encoded field of a struct.
+type field struct {
+	name string
+	typ  *typeInfo
+	tag  fieldTag
+}
+
+type generator struct {
+	pkg     string
+	types   map[string]*typeDecl
+	targets map[string]bool   // the types to generate methods for
+	imports map[string]string // imports of the generated file, name to path
+	buf     bytes.Buffer
+	n       int // counter for unique variable names
+}
+
+// Generate parses the Go files of the package in dir and returns the source of a
+// file declaring EncodeMtg and DecodeMtg methods for the named struct types.
+func Generate(dir string, typeNames []string) ([]byte, error) {
+	g, err := newGenerator(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range typeNames {
+		g.targets[name] = true
+	}
+
+	for _, name := range typeNames {
+		if err := g.generate(name); err != nil {
+			return nil, err
+		}
+	}
+
+	return g.source(typeNames)
+}
+
+// newGenerator parses the non-test Go files in dir.
+func newGenerator(dir string) (*generator, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+
+	g := &generator{
+		types:   map[string]*typeDecl{},
+		targets: map[string]bool{},
+		imports: map[string]string{"mtgpack": mtgpackPath},
+	}
+
+	fset := token.NewFileSet()
+	var methods []*ast.FuncDecl
+	for _, p := range paths {
+		if strings.HasSuffix(p, "_test.go") {
+			continue
+		}
+
+		f, err := parser.ParseFile(fset, p, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		if g.pkg == "" {
+			g.pkg = f.Name.Name
+		} else if f.Name.Name != g.pkg {
+			continue
+		}
+
+		imports := fileImports(f)
+		for _, decl := range f.Decls {
+			switch decl := decl.(type) {
+			case *ast.GenDecl:
+				if decl.Tok != token.TYPE {
+					continue
+				}
+
+				for _, spec := range decl.Specs {
+					spec := spec.(*ast.TypeSpec)
+					g.types[spec.Name.Name] = &typeDecl{
+						spec:    spec,
+						imports: imports,
+						methods: map[string]bool{},
+					}
+				}
+			case *ast.FuncDecl:
+				if decl.Recv != nil && len(decl.Recv.List) == 1 {
+					methods = append(methods, decl)
+				}
+			}
+		}
+	}
+
+	if g.pkg == "" {
+		return nil, fmt.Errorf("no Go files in %s", dir)
+	}
+
+	for _, m := range methods {
+		recv, ptr := m.Recv.List[0].Type, false
+		if star, ok := recv.(*ast.StarExpr); ok {
+			recv, ptr = star.X, true
+		}
+
+		if ident, ok := recv.(*ast.Ident); ok {
+			if decl, ok := g.types[ident.Name]; ok {
+				decl.methods[m.Name.Name] = ptr
+			}
+		}
+	}
+
+	return g, nil
+}
+
+// fileImports returns the imports of the file f, name to path.
+func fileImports(f *ast.File) map[string]string {
+	imports := map[string]string{}
+	for _, spec := range f.Imports {
+		p, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+
+		name := path.Base(p)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+
+		imports[name] = p
+	}
+
+	return imports
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+// name returns a variable name with the given prefix that is unique in the method.
+func (g *generator) name(prefix string) string {
+	g.n++
+	return prefix + strconv.Itoa(g.n)
+}
+
+// typeString returns the Go expression of the type expr declared in a file
+// with the given imports, recording the imports it may refer to.
+func (g *generator) typeString(expr ast.Expr, imports map[string]string) string {
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if pkg, ok := sel.X.(*ast.Ident); ok {
+				if p, ok := imports[pkg.Name]; ok {
+					g.imports[pkg.Name] = p
+				}
+			}
+		}
+
+		return true
+	})
+
+	return types.ExprString(expr)
+}
+
+// resolve returns how the type expr declared in a file with the given imports is encoded.
+func (g *generator) resolve(expr ast.Expr, imports map[string]string) (*typeInfo, error) {
+	typeExpr := g.typeString(expr, imports)
+
+	switch x := expr.(type) {
+	case *ast.ParenExpr:
+		return g.resolve(x.X, imports)
+	case *ast.Ident:
+		if decl, ok := g.types[x.Name]; ok {
+			return g.resolveDecl(decl)
+		}
+
+		if b, ok := basicTypes[x.Name]; ok {
+			b.expr = typeExpr
+			return &b, nil
+		}
+	case *ast.SelectorExpr:
+		pkg, ok := x.X.(*ast.Ident)
+		if !ok {
+			break
+		}
+
+		t := &typeInfo{kind: kindExternal, expr: typeExpr}
+		switch imports[pkg.Name] + "." + x.Sel.Name {
+		case "github.com/google/uuid.UUID":
+			t.kind = kindUUID
+		case "github.com/shopspring/decimal.Decimal":
+			t.kind, t.isZero = kindDecimal, true
+		case "time.Time":
+			t.kind, t.isZero = kindTime, true
+		case "math/big.Int":
+			t.kind = kindBigInt
+		}
+
+		return t, nil
+	case *ast.StarExpr:
+		elem, err := g.resolve(x.X, imports)
+		if err != nil {
+			return nil, err
+		}
+
+		return &typeInfo{kind: kindPointer, expr: typeExpr, elem: elem}, nil
+	case *ast.ArrayType:
+		elem, err := g.resolve(x.Elt, imports)
+		if err != nil {
+			return nil, err
+		}
+
+		isByte := elem.expr == "byte" || elem.expr == "uint8"
+		if x.Len == nil {
+			if isByte {
+				return &typeInfo{kind: kindBytes, expr: typeExpr}, nil
+			}
+
+			return &typeInfo{kind: kindSlice, expr: typeExpr, elem: elem}, nil
+		}
+
+		length := g.typeString(x.Len, imports)
+		if isByte {
+			return &typeInfo{kind: kindByteArray, expr: typeExpr, len: length}, nil
+		}
+
+		return &typeInfo{kind: kindArray, expr: typeExpr, len: length, elem: elem}, nil
+	case *ast.MapType:
+		key, err := g.resolve(x.Key, imports)
+		if err != nil {
+			return nil, err
+		}
+
+		elem, err := g.resolve(x.Value, imports)
+		if err != nil {
+			return nil, err
+		}
+
+		return &typeInfo{kind: kindMap, expr: typeExpr, key: key, elem: elem}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported type %s", typeExpr)
+}
+
+// resolveDecl returns how a type declared in the package is encoded.
+func (g *generator) resolveDecl(decl *typeDecl) (*typeInfo, error) {
+	name := decl.spec.Name.Name
+	if decl.spec.TypeParams != nil {
+		return nil, fmt.Errorf("unsupported generic type %s", name)
+	}
+
+	if decl.spec.Assign.IsValid() {
+		return g.resolve(decl.spec.Type, decl.imports)
+	}
+
+	if _, ok := decl.spec.Type.(*ast.InterfaceType); ok {
+		return &typeInfo{kind: kindInterface, expr: name}, nil
+	}
+
+	t := &typeInfo{kind: kindStruct, expr: name}
+	if _, ok := decl.spec.Type.(*ast.StructType); !ok {
+		u, err := g.resolve(decl.spec.Type, decl.imports)
+		if err != nil {
+			return nil, err
+		}
+
+		*t = typeInfo{kind: u.kind, expr: name, wire: u.wire, len: u.len, elem: u.elem, key: u.key}
+		switch u.kind {
+		case kindUUID:
+			t.kind, t.len = kindByteArray, "16"
+		case kindDecimal, kindTime, kindBigInt, kindExternal:
+			t.kind = kindStruct
+		}
+	}
+
+	if g.targets[name] {
+		t.encoder, t.decoder = true, true
+	}
+
+	// the values encoded are addressable, so methods with pointer receivers
+	// can be called on them too
+	if _, ok := decl.methods["EncodeMtg"]; ok {
+		t.encoder = true
+	}
+
+	if _, ok := decl.methods["DecodeMtg"]; ok {
+		t.decoder = true
+	}
+
+	// byte arrays keep their own encoding, like uuid.UUID, and types with only
+	// one of the methods are encoded by their fields, like in mtgpack.EncodeValue
+	if t.kind != kindByteArray {
+		_, marshal := decl.methods["MarshalBinary"]
+		_, unmarshal := decl.methods["UnmarshalBinary"]
+		t.binary = marshal && unmarshal
+	}
+
+	_, t.text = decl.methods["MarshalText"]
+
+	if ptr, ok := decl.methods["IsZero"]; ok && !ptr {
+		t.isZero = true
+	}
+
+	return t, nil
+}
+
+// structFields returns the encoded fields of the struct type declared by decl.
+func (g *generator) structFields(decl *typeDecl, st *ast.StructType) ([]field, error) {
+	var fields []field
+	for _, f := range st.Fields.List {
+		names := make([]string, 0, len(f.Names))
+		for _, ident := range f.Names {
+			names = append(names, ident.Name)
+		}
+
+		if len(names) == 0 {
+			names = append(names, embeddedName(f.Type))
+		}
+
+		var tag string
+		if f.Tag != nil {
+			s, err := strconv.Unquote(f.Tag.Value)
+			if err != nil {
+				return nil, err
+			}
+
+			tag = reflect.StructTag(s).Get("mtg")
+		}
+
+		for _, name := range names {
+			if !ast.IsExported(name) {
+				continue
+			}
+
+			t, err := g.resolve(f.Type, decl.imports)
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %w", decl.spec.Name.Name, name, err)
+			}
+
+			ft, err := parseTag(tag, t)
+			if err != nil {
+				return nil, fmt.Errorf("invalid mtg tag on %s.%s: %w", decl.spec.Name.Name, name, err)
+			}
+
+			if ft.skip {
+				continue
+			}
+
+			fields = append(fields, field{name: name, typ: t, tag: ft})
+		}
+	}
+
+	return fields, nil
+}
+
+// embeddedName returns the field name of an embedded field of type expr.
+func embeddedName(expr ast.Expr) string {
+	switch x := expr.(type) {
+	case *ast.Ident:
+		return x.Name
+	case *ast.StarExpr:
+		return embeddedName(x.X)
+	case *ast.SelectorExpr:
+		return x.Sel.Name
+	case *ast.IndexExpr:
+		return embeddedName(x.X)
+	case *ast.IndexListExpr:
+		return embeddedName(x.X)
+	}
+
+	return ""
+}
+
+// receiverName returns the receiver name of the methods of the named type,
+// avoiding the names of the Encoder and Decoder parameters.
+func receiverName(typeName string) string {
+	r := strings.ToLower(typeName[:1])
+	if r == "e" || r == "d" || !token.IsIdentifier(r) {
+		return "x"
+	}
+
+	return r
+}
+
+// generate writes the EncodeMtg and DecodeMtg methods of the named type.
+func (g *generator) generate(name string) error {
+	decl, ok := g.types[name]
+	if !ok {
+		return fmt.Errorf("type %s not found", name)
+	}
+
+	st, ok := decl.spec.Type.(*ast.StructType)
+	if !ok || decl.spec.Assign.IsValid() {
+		return fmt.Errorf("type %s is not a struct type", name)
+	}
+
+	if decl.spec.TypeParams != nil {
+		return fmt.Errorf("unsupported generic type %s", name)
+	}
+
+	fields, err := g.structFields(decl, st)
+	if err != nil {
+		return err
+	}
+
+	recv := receiverName(name)
+
+	g.n = 0
+	g.printf("func (%s %s) EncodeMtg(e *mtgpack.Encoder) error {\n", recv, name)
+	for _, f := range fields {
+		if err := g.encode(f.typ, recv+"."+f.name, f.tag); err != nil {
+			return fmt.Errorf("%s.%s: %w", name, f.name, err)
+		}
+
+		g.printf("\n")
+	}
+
+	g.printf("return nil\n}\n\n")
+
+	g.n = 0
+	g.printf("func (%s *%s) DecodeMtg(d *mtgpack.Decoder) error {\n", recv, name)
+	if len(fields) > 0 {
+		g.printf("var err error\n\n")
+	}
+
+	for _, f := range fields {
+		// name the field in the paths of errors and trace spans
+		g.printf("d.EnterField(%q)\n", f.name)
+		if err := g.decode(f.typ, recv+"."+f.name, f.tag); err != nil {
+			return fmt.Errorf("%s.%s: %w", name, f.name, err)
+		}
+
+		g.printf("\nd.Exit()\n\n")
+	}
+
+	g.printf("return nil\n}\n\n")
+	return nil
+}
+
+// check writes a statement returning the error of call, if any.
+func (g *generator) check(call string) {
+	g.printf("if err := %s; err != nil {\nreturn err\n}\n", call)
+}
+
+// assign writes a statement assigning the results of call to v and err,
+// returning err if it is not nil. If v is empty, only err is assigned.
+func (g *generator) assign(v, call string) {
+	if v == "" {
+		g.printf("if err = %s; err != nil {\nreturn err\n}\n", call)
+		return
+	}
+
+	g.printf("if %s, err = %s; err != nil {\nreturn err\n}\n", v, call)
+}
+
+// operand returns v parenthesized if it is a dereference, so that it can be
+// used as the operand of a selector, index or slice expression.
+func operand(v string) string {
+	if strings.HasPrefix(v, "*") {
+		return "(" + v + ")"
+	}
+
+	return v
+}
+
+// addr returns the expression of the address of v.
+func addr(v string) string {
+	if strings.HasPrefix(v, "*") {
+		return v[1:]
+	}
+
+	return "&" + v
+}
+
+// timeUnit returns the expression of the time unit of the tag, zero for the
+// default unit of the Encoder or Decoder.
+func timeUnit(tag fieldTag) string {
+	if tag.unit == "" {
+		return "0"
+	}
+
+	return tag.unit
+}
+
+// withLen returns the call of the Encoder or Decoder method with the suffix
+// name on v, with the length prefix p unless it is the default one.
+func withLen(name, v, p string) string {
+	if p == "0" {
+		return name + "(" + v + ")"
+	}
+
+	return name + "Len(" + v + ", " + p + ")"
+}
+
+// method returns the name of the Encoder or Decoder method suffix for the basic type wire.
+func method(wire string) string {
+	return strings.ToUpper(wire[:1]) + wire[1:]
+}
+
+// convert returns the expression converting v of type t to the basic type wire.
+func convert(wire string, t *typeInfo, v string) string {
+	if t.expr == wire || basicTypes[t.expr].wire == wire && (t.expr == "byte" || t.expr == "rune") {
+		return v
+	}
+
+	return wire + "(" + v + ")"
+}
+
+// nonZero returns the expression reporting whether v of type t is not the zero
+// value, like the zeroChecker function of the mtgpack package.
+func (g *generator) nonZero(t *typeInfo, v string) (string, error) {
+	if t.isZero {
+		return "!" + operand(v) + ".IsZero()", nil
+	}
+
+	switch t.kind {
+	case kindInt, kindUint:
+		return v + " != 0", nil
+	case kindFloat:
+		// compare the bits, reflect.Value.IsZero does not consider -0 zero
+		g.imports["math"] = "math"
+		if t.wire == "float32" {
+			return "math.Float32bits(" + convert("float32", t, v) + ") != 0", nil
+		}
+
+		return "math.Float64bits(" + convert("float64", t, v) + ") != 0", nil
+	case kindBool:
+		return v, nil
+	case kindString:
+		return v + ` != ""`, nil
+	case kindBytes, kindSlice, kindMap, kindPointer, kindInterface:
+		return v + " != nil", nil
+	case kindUUID, kindByteArray, kindArray, kindStruct:
+		return v + " != (" + t.expr + "{})", nil
+	}
+
+	return "", fmt.Errorf("option \"optional\" is not supported on %s", t.expr)
+}
+
+// zero returns the zero value of the type t.
+func zero(t *typeInfo) string {
+	switch t.kind {
+	case kindInt, kindUint, kindFloat:
+		return "0"
+	case kindBool:
+		return "false"
+	case kindString:
+		return `""`
+	case kindBytes, kindSlice, kindMap, kindPointer, kindInterface:
+		return "nil"
+	}
+
+	return t.expr + "{}"
+}
+
+// encode writes the statements encoding v of type t, nested in a struct, slice
+// or map, like the encoders returned by newValueEncoder in the mtgpack package.
+func (g *generator) encode(t *typeInfo, v string, tag fieldTag) error {
+	if t.kind == kindPointer {
+		g.check("e.EncodeBool(" + v + " != nil)")
+		g.printf("\nif %s != nil {\n", v)
+		defer g.printf("}\n")
+
+		if t.elem.encoder {
+			g.check(v + ".EncodeMtg(e)")
+			return nil
+		}
+
+		return g.encodeElem(t.elem, "*"+v, tag)
+	}
+
+	if tag.optional {
+		present, err := g.nonZero(t, v)
+		if err != nil {
+			return err
+		}
+
+		g.check("e.EncodeBool(" + present + ")")
+		g.printf("\nif %s {\n", present)
+		defer g.printf("}\n")
+	}
+
+	return g.encodeElem(t, v, tag)
+}
+
+// encodeElem writes the statements encoding v of type t, like the encoders
+// returned by newElemEncoder in the mtgpack package.
+func (g *generator) encodeElem(t *typeInfo, v string, tag fieldTag) error {
+	if t.encoder {
+		g.check(operand(v) + ".EncodeMtg(e)")
+		return nil
+	}
+
+	if tag.text {
+		g.check("e.Encode" + withLen("Text", addr(v), tag.len))
+		return nil
+	}
+
+	if t.kind == kindTime && (tag.typ != "" || tag.varint) {
+		x := g.name("v")
+		g.printf("%s, err := e.TimeToUnix(%s, %s)\nif err != nil {\nreturn err\n}\n\n", x, v, timeUnit(tag))
+
+		b := basicTypes["int64"]
+		b.expr = "int64"
+		return g.encodeElem(&b, x, fieldTag{typ: tag.typ, varint: tag.varint})
+	}
+
+	if tag.typ != "" {
+		x := g.name("v")
+		g.printf("%s, err := mtgpack.ConvertInt[%s](%s)\nif err != nil {\nreturn err\n}\n\n", x, tag.typ, v)
+
+		b := basicTypes[tag.typ]
+		b.expr = tag.typ
+		return g.encodeElem(&b, x, fieldTag{varint: tag.varint})
+	}
+
+	if tag.varint {
+		if t.kind == kindInt {
+			g.check("e.EncodeVarint(" + convert("int64", t, v) + ")")
+		} else {
+			g.check("e.EncodeUvarint(" + convert("uint64", t, v) + ")")
+		}
+
+		return nil
+	}
+
+	if t.binary || t.kind == kindExternal && tag.len != "0" {
+		g.check("e.Encode" + withLen("Binary", addr(v), tag.len))
+		return nil
+	}
+
+	switch t.kind {
+	case kindInt, kindUint, kindFloat, kindBool:
+		g.check("e.Encode" + method(t.wire) + "(" + convert(t.wire, t, v) + ")")
+	case kindString:
+		if tag.len != "0" {
+			g.check("e.EncodeStringLen(" + convert("string", t, v) + ", " + tag.len + ")")
+		} else {
+			g.check("e.EncodeString(" + convert("string", t, v) + ")")
+		}
+	case kindBytes:
+		if tag.len != "0" {
+			g.check("e.EncodeBytesLen(" + v + ", " + tag.len + ")")
+		} else {
+			g.check("e.EncodeBytes(" + v + ")")
+		}
+	case kindUUID:
+		g.check("e.EncodeUUID(" + v + ")")
+	case kindDecimal:
+		switch {
+		case tag.prec != "":
+			g.check("e.EncodeDecimalPrec(" + v + ", " + tag.prec + ")")
+		case tag.big:
+			g.check("e.EncodeBigDecimal(" + v + ")")
+		default:
+			g.check("e.EncodeDecimal(" + v + ")")
+		}
+	case kindBigInt:
+		g.check("e.EncodeBigInt(" + addr(v) + ")")
+	case kindTime:
+		if tag.unit != "" {
+			g.check("e.EncodeTimeUnit(" + v + ", " + tag.unit + ")")
+		} else {
+			g.check("e.EncodeTime(" + v + ")")
+		}
+	case kindByteArray:
+		g.printf("if _, err := e.Write(%s[:]); err != nil {\nreturn err\n}\n", operand(v))
+	case kindSlice, kindArray:
+		if t.kind == kindSlice {
+			g.check("e.EncodeLen(len(" + v + "), " + tag.len + ")")
+			g.printf("\n")
+		}
+
+		i := g.name("i")
+		g.printf("for %s := range %s {\n", i, v)
+		if err := g.encode(t.elem, operand(v)+"["+i+"]", fieldTag{len: "0"}); err != nil {
+			return err
+		}
+
+		g.printf("}\n")
+	case kindMap:
+		g.printf("if err := mtgpack.EncodeMap[%s, %s](e, %s, %s, ", t.key.expr, t.elem.expr, v, tag.len)
+		if err := g.encodeFunc(t.key); err != nil {
+			return err
+		}
+
+		g.printf(", ")
+		if err := g.encodeFunc(t.elem); err != nil {
+			return err
+		}
+
+		g.printf("); err != nil {\nreturn err\n}\n")
+	case kindInterface:
+		g.check("mtgpack.EncodeUnion[" + t.expr + "](e, " + v + ")")
+	case kindStruct, kindExternal:
+		g.check("mtgpack.EncodeValue(e, " + v + ")")
+	default:
+		return fmt.Errorf("unsupported type %s", t.expr)
+	}
+
+	return nil
+}
+
+// encodeFunc writes a function literal encoding a map key or value of type t.
+func (g *generator) encodeFunc(t *typeInfo) error {
+	v := g.name("v")
+	g.printf("func(e *mtgpack.Encoder, %s %s) error {\n", v, t.expr)
+	if err := g.encode(t, v, fieldTag{len: "0"}); err != nil {
+		return err
+	}
+
+	g.printf("\nreturn nil\n}")
+	return nil
+}
+
+// decode writes the statements decoding into v of type t, nested in a struct,
+// slice or map, like the decoders returned by newValueDecoder in the mtgpack package.
+func (g *generator) decode(t *typeInfo, v string, tag fieldTag) error {
+	if t.kind != kindPointer && !tag.optional {
+		return g.decodeElem(t, v, tag)
+	}
+
+	var offset string
+	if t.kind != kindPointer {
+		offset = g.name("offset")
+		g.printf("%s := d.Offset()\n", offset)
+	}
+
+	ok := g.name("ok")
+	g.printf("var %s bool\n", ok)
+	g.assign(ok, "d.DecodeBool()")
+	g.printf("\nif %s {\n", ok)
+
+	if t.kind == kindPointer {
+		g.printf("if %s == nil {\n%s = new(%s)\n}\n\n", v, v, t.elem.expr)
+		if t.elem.decoder {
+			g.assign("", v+".DecodeMtg(d)")
+		} else if err := g.decodeElem(t.elem, "*"+v, tag); err != nil {
+			return err
+		}
+	} else {
+		if err := g.decodeElem(t, v, tag); err != nil {
+			return err
+		}
+
+		// present zero values are not canonical, see Decoder.CheckOptional
+		present, err := g.nonZero(t, v)
+		if err != nil {
+			return err
+		}
+
+		g.printf("\n")
+		g.assign("", "d.CheckOptional("+offset+", "+present+")")
+	}
+
+	g.printf("} else {\n%s = %s\n}\n", v, zero(t))
+	return nil
+}
+
+// decodeElem writes the statements decoding into v of type t, like the
+// decoders returned by newElemDecoder in the mtgpack package.
+func (g *generator) decodeElem(t *typeInfo, v string, tag fieldTag) error {
+	if t.decoder {
+		g.assign("", operand(v)+".DecodeMtg(d)")
+		return nil
+	}
+
+	if tag.text {
+		g.assign("", "d.Decode"+withLen("Text", addr(v), tag.len))
+		return nil
+	}
+
+	if t.kind == kindTime && (tag.typ != "" || tag.varint) {
+		x := g.name("v")
+		g.printf("var %s int64\n", x)
+
+		b := basicTypes["int64"]
+		b.expr = "int64"
+		if err := g.decodeElem(&b, x, fieldTag{typ: tag.typ, varint: tag.varint}); err != nil {
+			return err
+		}
+
+		g.printf("\n%s = d.TimeFromUnix(%s, %s)\n", v, x, timeUnit(tag))
+		if tag.utc {
+			g.printf("%s = %s.UTC()\n", v, operand(v))
+		}
+
+		return nil
+	}
+
+	if tag.typ != "" {
+		x := g.name("v")
+		g.printf("var %s %s\n", x, tag.typ)
+
+		b := basicTypes[tag.typ]
+		b.expr = tag.typ
+		if err := g.decodeElem(&b, x, fieldTag{varint: tag.varint}); err != nil {
+			return err
+		}
+
+		g.printf("\n")
+		g.assign(v, "mtgpack.ConvertInt["+t.expr+"]("+x+")")
+		return nil
+	}
+
+	if tag.varint {
+		call, wire := "d.DecodeUvarint()", "uint64"
+		if t.kind == kindInt {
+			call, wire = "d.DecodeVarint()", "int64"
+		}
+
+		if t.expr == wire {
+			g.assign(v, call)
+			return nil
+		}
+
+		x := g.name("v")
+		g.printf("var %s %s\n", x, wire)
+		g.assign(x, call)
+		g.printf("\n")
+		g.assign(v, "mtgpack.ConvertInt["+t.expr+"]("+x+")")
+		return nil
+	}
+
+	if t.binary || t.kind == kindExternal && tag.len != "0" {
+		g.assign("", "d.Decode"+withLen("Binary", addr(v), tag.len))
+		return nil
+	}
+
+	switch t.kind {
+	case kindInt, kindUint, kindFloat, kindBool:
+		g.decodeConvert(t, v, "d.Decode"+method(t.wire)+"()", t.wire)
+	case kindString:
+		if tag.len != "0" {
+			g.decodeConvert(t, v, "d.DecodeStringLen("+tag.len+")", "string")
+		} else {
+			g.decodeConvert(t, v, "d.DecodeString()", "string")
+		}
+	case kindBytes:
+		if tag.len != "0" {
+			g.assign(v, "d.DecodeBytesLen("+tag.len+")")
+		} else {
+			g.assign(v, "d.DecodeBytes()")
+		}
+	case kindUUID:
+		g.assign(v, "d.DecodeUUID()")
+	case kindDecimal:
+		switch {
+		case tag.prec != "":
+			g.assign(v, "d.DecodeDecimalPrec("+tag.prec+")")
+		case tag.big:
+			g.assign(v, "d.DecodeBigDecimal()")
+		default:
+			g.assign(v, "d.DecodeDecimal()")
+		}
+	case kindBigInt:
+		x := g.name("x")
+		g.printf("var %s *%s\n", x, t.expr)
+		g.assign(x, "d.DecodeBigInt()")
+		g.printf("%s.Set(%s)\n", strings.TrimPrefix(v, "*"), x)
+	case kindTime:
+		if tag.unit != "" {
+			g.assign(v, "d.DecodeTimeUnit("+tag.unit+")")
+		} else {
+			g.assign(v, "d.DecodeTime()")
+		}
+
+		if tag.utc {
+			g.printf("%s = %s.UTC()\n", v, operand(v))
+		}
+	case kindByteArray:
+		g.assign("", "d.ReadFull("+operand(v)+"[:])")
+	case kindSlice, kindArray:
+		var i string
+		if t.kind == kindSlice {
+			// append the elements as they are decoded, see mtgpack.MakeSlice
+			n := g.name("n")
+			g.printf("var %s int\n", n)
+			g.assign(n, "d.DecodeLen("+tag.len+")")
+			g.printf("\n")
+			g.assign(v, "mtgpack.MakeSlice["+t.expr+"](d, "+v+", "+n+")")
+
+			i = g.name("i")
+			g.printf("\nfor %s := 0; %s < %s; %s++ {\n", i, i, n, i)
+			g.printf("%s = append(%s, %s)\n", v, v, zero(t.elem))
+		} else {
+			i = g.name("i")
+			g.printf("for %s := range %s {\n", i, v)
+		}
+
+		g.printf("d.EnterIndex(%s)\n", i)
+		if err := g.decode(t.elem, operand(v)+"["+i+"]", fieldTag{len: "0"}); err != nil {
+			return err
+		}
+
+		g.printf("\nd.Exit()\n}\n")
+	case kindMap:
+		g.printf("if %s, err = mtgpack.DecodeMap[%s, %s](d, %s, ", v, t.key.expr, t.elem.expr, tag.len)
+		if err := g.decodeFunc(t.key); err != nil {
+			return err
+		}
+
+		g.printf(", ")
+		if err := g.decodeFunc(t.elem); err != nil {
+			return err
+		}
+
+		g.printf("); err != nil {\nreturn err\n}\n")
+	case kindInterface:
+		g.assign(v, "mtgpack.DecodeUnion["+t.expr+"](d)")
+	case kindStruct, kindExternal:
+		g.assign("", "mtgpack.DecodeValue(d, "+addr(v)+")")
+	default:
+		return fmt.Errorf("unsupported type %s", t.expr)
+	}
+
+	return nil
+}
+
+// decodeConvert writes the statements decoding into v of type t with call,
+// which returns the basic type wire.
+func (g *generator) decodeConvert(t *typeInfo, v, call, wire string) {
+	if convert(wire, t, v) == v {
+		g.assign(v, call)
+		return
+	}
+
+	x := g.name("v")
+	g.printf("var %s %s\n", x, wire)
+	g.assign(x, call)
+	g.printf("\n%s = %s(%s)\n", v, t.expr, x)
+}
+
+// decodeFunc writes a function literal decoding a map key or value of type t.
+func (g *generator) decodeFunc(t *typeInfo) error {
+	v := g.name("v")
+	g.printf("func(d *mtgpack.Decoder, %s *%s) error {\nvar err error\n\n", v, t.expr)
+	if err := g.decode(t, "*"+v, fieldTag{len: "0"}); err != nil {
+		return err
+	}
+
+	g.printf("\nreturn nil\n}")
+	return nil
+}
+
+// source returns the formatted source of the generated file.
+func (g *generator) source(typeNames []string) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by \"mtgpackgen -type %s\"; DO NOT EDIT.\n\n", strings.Join(typeNames, ","))
+	fmt.Fprintf(&buf, "package %s\n\n", g.pkg)
+
+	var std, other []string
+	for name, p := range g.imports {
+		// imports are recorded for every type resolved, keep the ones the code refers to
+		if !regexp.MustCompile(`(^|[^\w.])` + regexp.QuoteMeta(name) + `\.`).Match(g.buf.Bytes()) {
+			continue
+		}
+
+		spec := strconv.Quote(p)
+		if name != path.Base(p) {
+			spec = name + " " + spec
+		}
+
+		if strings.Contains(strings.Split(p, "/")[0], ".") {
+			other = append(other, spec)
+		} else {
+			std = append(std, spec)
+		}
+	}
+
+	sort.Strings(std)
+	sort.Strings(other)
+
+	buf.WriteString("import (\n")
+	for _, spec := range std {
+		buf.WriteString(spec + "\n")
+	}
+
+	if len(std) > 0 {
+		buf.WriteString("\n")
+	}
+
+	for _, spec := range other {
+		buf.WriteString(spec + "\n")
+	}
+
+	buf.WriteString(")\n\n")
+	buf.Write(g.buf.Bytes())
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated code: %w", err)
+	}
+
+	return src, nil
+}
@@ -0,0 +1,137 @@
+// Package example declares types covering the features of mtgpackgen, to check
+// that the generated code is byte-compatible with the reflection path.
+package example
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pandodao/mtg/mtgpack"
+	"github.com/shopspring/decimal"
+)
+
+//go:generate go run ../.. -type Order,Leg,Node
+
+type Side uint8
+
+type AssetID uuid.UUID
+
+type Weights map[uuid.UUID]decimal.Decimal
+
+type Order struct {
+	ID        uuid.UUID
+	FollowID  uuid.UUID `mtg:",optional"`
+	Side      Side
+	Count     int               `mtg:"uint16"`
+	Nonce     uint64            `mtg:",varint"`
+	Offset    int32             `mtg:"int16,varint"`
+	Price     decimal.Decimal   `mtg:",optional"`
+	Rate      float64           `mtg:",optional"`
+	Ratio     float32           `mtg:",optional"`
+	Deadline  time.Time         `mtg:",optional"`
+	Memo      string            `mtg:",len=uint16"`
+	Extra     []byte            `mtg:",len=uvarint"`
+	Asset     AssetID           `mtg:",optional"`
+	Hash      [4]byte           `mtg:",optional"`
+	Quotes    [2]uint16         `mtg:",optional"`
+	Legs      []Leg             `mtg:",len=uint16"`
+	Refund    *Leg              `mtg:",optional"`
+	Limit     *int64            `mtg:"uint32"`
+	Weights   Weights           `mtg:",optional"`
+	Labels    map[string][]Side `mtg:",len=uint8"`
+	Routes    [][]uuid.UUID
+	Fallback  Fallback
+	Approved  bool `mtg:",optional"`
+	Signature []byte
+	Supply    *big.Int
+	Volume    decimal.Decimal `mtg:",big"`
+	Expiry    time.Time       `mtg:"uint32,unix,utc,optional"`
+	Created   time.Time       `mtg:",unixmilli,varint"`
+	Settled   *time.Time      `mtg:",unix"`
+	Action    Action          `mtg:",optional"`
+	Version   Version
+	Minimum   *Version  `mtg:",len=uint16"`
+	Release   Version   `mtg:",text"`
+	Peer      net.IP    `mtg:",text,len=uint8"`
+	Ref       uuid.UUID `mtg:",text"`
+	Rebate    Amount
+	Internal  string `mtg:"-"`
+	internal  string
+}
+
+type Leg struct {
+	Asset  uuid.UUID
+	Amount decimal.Decimal
+	Tag    *string
+	Fee    *decimal.Decimal `mtg:",prec=18"`
+	Raw    big.Int
+}
+
+// Node is a recursive type, to check the depth limit of generated methods.
+type Node struct {
+	Value    uint8
+	Next     *Node
+	Children []Node
+}
+
+// Fallback has no generated methods, so it is encoded with reflection.
+type Fallback struct {
+	Name  string
+	Count uint8
+}
+
+// Version is encoded by its MarshalBinary method, or MarshalText with the text
+// option.
+type Version struct {
+	Major, Minor uint8
+}
+
+func (v Version) MarshalBinary() ([]byte, error) {
+	return []byte{v.Major, v.Minor}, nil
+}
+
+func (v *Version) UnmarshalBinary(b []byte) error {
+	if len(b) != 2 {
+		return fmt.Errorf("invalid version length %d", len(b))
+	}
+
+	v.Major, v.Minor = b[0], b[1]
+	return nil
+}
+
+func (v Version) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("%d.%d", v.Major, v.Minor)), nil
+}
+
+func (v *Version) UnmarshalText(b []byte) error {
+	_, err := fmt.Sscanf(string(b), "%d.%d", &v.Major, &v.Minor)
+	return err
+}
+
+// Amount is encoded by EncodeMtg and DecodeMtg methods with pointer receivers.
+type Amount uint64
+
+func (a *Amount) EncodeMtg(e *mtgpack.Encoder) error {
+	return e.EncodeUvarint(uint64(*a))
+}
+
+func (a *Amount) DecodeMtg(d *mtgpack.Decoder) error {
+	x, err := d.DecodeUvarint()
+	*a = Amount(x)
+	return err
+}
+
+// Action is a union of Leg and Fallback.
+type Action interface {
+	isAction()
+}
+
+func (*Leg) isAction()     {}
+func (Fallback) isAction() {}
+
+func init() {
+	mtgpack.RegisterUnion[Action](map[uint8]Action{1: &Leg{}, 2: Fallback{}})
+}
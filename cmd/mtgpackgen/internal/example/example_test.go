@@ -0,0 +1,174 @@
+package example
+
+import (
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pandodao/mtg/mtgpack"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// plainOrder and plainLeg have the fields of Order and Leg without their
+// generated methods, so they are encoded with reflection.
+type (
+	plainOrder Order
+	plainLeg   Leg
+)
+
+func testOrders() []Order {
+	tag := "refund"
+	fee := decimal.RequireFromString("0.000000000000000123")
+	limit := int64(100)
+	settled := time.Unix(1700000001, 0)
+
+	return []Order{
+		{},
+		{
+			ID:       uuid.New(),
+			FollowID: uuid.New(),
+			Side:     2,
+			Count:    300,
+			Nonce:    1 << 40,
+			Offset:   -1000,
+			Price:    decimal.NewFromFloat(1.5),
+			Rate:     0.25,
+			Ratio:    -1,
+			Deadline: time.Unix(1700000000, 0),
+			Memo:     "hello",
+			Extra:    []byte{1, 2, 3},
+			Asset:    AssetID(uuid.New()),
+			Hash:     [4]byte{1, 2, 3, 4},
+			Quotes:   [2]uint16{5, 6},
+			Legs: []Leg{
+				{Asset: uuid.New(), Amount: decimal.NewFromInt(10)},
+				{Asset: uuid.New(), Amount: decimal.NewFromInt(20), Tag: &tag, Fee: &fee, Raw: *big.NewInt(-42)},
+			},
+			Refund: &Leg{Asset: uuid.New(), Amount: decimal.NewFromInt(1)},
+			Limit:  &limit,
+			Weights: Weights{
+				uuid.New(): decimal.NewFromFloat(0.5),
+				uuid.New(): decimal.NewFromFloat(0.3),
+				uuid.New(): decimal.NewFromFloat(0.2),
+			},
+			Labels: map[string][]Side{
+				"bb": {1, 2},
+				"a":  {3},
+				"":   {},
+			},
+			Routes:    [][]uuid.UUID{{uuid.New()}, {uuid.New(), uuid.New()}, nil},
+			Fallback:  Fallback{Name: "fallback", Count: 3},
+			Approved:  true,
+			Signature: []byte("signature"),
+			Supply:    new(big.Int).Lsh(big.NewInt(1), 255),
+			Volume:    decimal.RequireFromString("-123456789012345678901234567890.123456789012345678"),
+			Expiry:    time.Unix(1700000000, 0),
+			Created:   time.UnixMilli(1700000000123),
+			Settled:   &settled,
+			Action:    &Leg{Asset: uuid.New(), Amount: decimal.NewFromInt(5)},
+			Version:   Version{Major: 1, Minor: 2},
+			Minimum:   &Version{Major: 1},
+			Release:   Version{Major: 2, Minor: 10},
+			Peer:      net.ParseIP("10.0.0.1"),
+			Ref:       uuid.New(),
+			Rebate:    300,
+			Internal:  "skipped",
+		},
+	}
+}
+
+func TestGeneratedEncode(t *testing.T) {
+	for _, order := range testOrders() {
+		want := mtgpack.NewEncoder()
+		require.NoError(t, mtgpack.EncodeValue(want, plainOrder(order)))
+
+		got := mtgpack.NewEncoder()
+		require.NoError(t, order.EncodeMtg(got))
+		assert.Equal(t, want.Bytes(), got.Bytes())
+
+		for _, leg := range order.Legs {
+			want := mtgpack.NewEncoder()
+			require.NoError(t, mtgpack.EncodeValue(want, plainLeg(leg)))
+
+			got := mtgpack.NewEncoder()
+			require.NoError(t, leg.EncodeMtg(got))
+			assert.Equal(t, want.Bytes(), got.Bytes())
+		}
+	}
+}
+
+func TestGeneratedDecode(t *testing.T) {
+	for _, order := range testOrders() {
+		e := mtgpack.NewEncoder()
+		require.NoError(t, mtgpack.EncodeValue(e, plainOrder(order)))
+
+		var want plainOrder
+		require.NoError(t, mtgpack.DecodeAll(mtgpack.NewDecoder(e.Bytes()), &want))
+
+		d := mtgpack.NewDecoder(e.Bytes())
+		d.SetOptions(mtgpack.DecoderOptions{Strict: true})
+
+		var got Order
+		require.NoError(t, got.DecodeMtg(d))
+		assert.Zero(t, d.Remaining())
+		assert.Equal(t, Order(want), got)
+	}
+}
+
+func TestGeneratedMaxDepth(t *testing.T) {
+	root := &Node{}
+	for n, i := root, 0; i < 50; i++ {
+		n.Next = &Node{Value: uint8(i)}
+		n = n.Next
+	}
+
+	e := mtgpack.NewEncoder()
+	require.NoError(t, root.EncodeMtg(e))
+
+	opts := mtgpack.DecoderOptions{MaxDepth: 5}
+	d := mtgpack.NewDecoder(e.Bytes())
+	d.SetOptions(opts)
+
+	var got Node
+	err := got.DecodeMtg(d)
+	assert.ErrorIs(t, err, mtgpack.ErrLimitExceeded)
+
+	var de *mtgpack.DecodeError
+	require.ErrorAs(t, err, &de)
+	assert.Equal(t, "Next.Next.Next.Next.Next.Value", de.Path)
+
+	// like the reflection path
+	d = mtgpack.NewDecoder(e.Bytes())
+	d.SetOptions(opts)
+
+	type plainNode Node
+	var want plainNode
+	assert.ErrorIs(t, mtgpack.DecodeValue(d, &want), mtgpack.ErrLimitExceeded)
+
+	d = mtgpack.NewDecoder(e.Bytes())
+	d.SetOptions(mtgpack.DecoderOptions{MaxDepth: 101})
+	require.NoError(t, got.DecodeMtg(d))
+
+	e2 := mtgpack.NewEncoder()
+	require.NoError(t, got.EncodeMtg(e2))
+	assert.Equal(t, e.Bytes(), e2.Bytes())
+}
+
+func TestGeneratedErrors(t *testing.T) {
+	order := Order{Count: -1}
+	assert.ErrorIs(t, order.EncodeMtg(mtgpack.NewEncoder()), mtgpack.ErrOverflow)
+
+	e := mtgpack.NewEncoder()
+	require.NoError(t, Order{}.EncodeMtg(e))
+
+	b := e.Bytes()
+	for i := range b {
+		var got Order
+		err := got.DecodeMtg(mtgpack.NewDecoder(b[:i]))
+		assert.ErrorIs(t, err, mtgpack.ErrUnexpectedEOF, "truncated at %d", i)
+	}
+}
@@ -0,0 +1,1159 @@
+// Code generated by "mtgpackgen -type Order,Leg,Node"; DO NOT EDIT.
+
+package example
+
+import (
+	"math"
+	"math/big"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pandodao/mtg/mtgpack"
+	"github.com/shopspring/decimal"
+)
+
+func (o Order) EncodeMtg(e *mtgpack.Encoder) error {
+	if err := e.EncodeUUID(o.ID); err != nil {
+		return err
+	}
+
+	if err := e.EncodeBool(o.FollowID != (uuid.UUID{})); err != nil {
+		return err
+	}
+
+	if o.FollowID != (uuid.UUID{}) {
+		if err := e.EncodeUUID(o.FollowID); err != nil {
+			return err
+		}
+	}
+
+	if err := e.EncodeUint8(uint8(o.Side)); err != nil {
+		return err
+	}
+
+	v1, err := mtgpack.ConvertInt[uint16](o.Count)
+	if err != nil {
+		return err
+	}
+
+	if err := e.EncodeUint16(v1); err != nil {
+		return err
+	}
+
+	if err := e.EncodeUvarint(o.Nonce); err != nil {
+		return err
+	}
+
+	v2, err := mtgpack.ConvertInt[int16](o.Offset)
+	if err != nil {
+		return err
+	}
+
+	if err := e.EncodeVarint(int64(v2)); err != nil {
+		return err
+	}
+
+	if err := e.EncodeBool(!o.Price.IsZero()); err != nil {
+		return err
+	}
+
+	if !o.Price.IsZero() {
+		if err := e.EncodeDecimal(o.Price); err != nil {
+			return err
+		}
+	}
+
+	if err := e.EncodeBool(math.Float64bits(o.Rate) != 0); err != nil {
+		return err
+	}
+
+	if math.Float64bits(o.Rate) != 0 {
+		if err := e.EncodeFloat64(o.Rate); err != nil {
+			return err
+		}
+	}
+
+	if err := e.EncodeBool(math.Float32bits(o.Ratio) != 0); err != nil {
+		return err
+	}
+
+	if math.Float32bits(o.Ratio) != 0 {
+		if err := e.EncodeFloat32(o.Ratio); err != nil {
+			return err
+		}
+	}
+
+	if err := e.EncodeBool(!o.Deadline.IsZero()); err != nil {
+		return err
+	}
+
+	if !o.Deadline.IsZero() {
+		if err := e.EncodeTime(o.Deadline); err != nil {
+			return err
+		}
+	}
+
+	if err := e.EncodeStringLen(o.Memo, mtgpack.LenUint16); err != nil {
+		return err
+	}
+
+	if err := e.EncodeBytesLen(o.Extra, mtgpack.LenUvarint); err != nil {
+		return err
+	}
+
+	if err := e.EncodeBool(o.Asset != (AssetID{})); err != nil {
+		return err
+	}
+
+	if o.Asset != (AssetID{}) {
+		if _, err := e.Write(o.Asset[:]); err != nil {
+			return err
+		}
+	}
+
+	if err := e.EncodeBool(o.Hash != ([4]byte{})); err != nil {
+		return err
+	}
+
+	if o.Hash != ([4]byte{}) {
+		if _, err := e.Write(o.Hash[:]); err != nil {
+			return err
+		}
+	}
+
+	if err := e.EncodeBool(o.Quotes != ([2]uint16{})); err != nil {
+		return err
+	}
+
+	if o.Quotes != ([2]uint16{}) {
+		for i3 := range o.Quotes {
+			if err := e.EncodeUint16(o.Quotes[i3]); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := e.EncodeLen(len(o.Legs), mtgpack.LenUint16); err != nil {
+		return err
+	}
+
+	for i4 := range o.Legs {
+		if err := o.Legs[i4].EncodeMtg(e); err != nil {
+			return err
+		}
+	}
+
+	if err := e.EncodeBool(o.Refund != nil); err != nil {
+		return err
+	}
+
+	if o.Refund != nil {
+		if err := o.Refund.EncodeMtg(e); err != nil {
+			return err
+		}
+	}
+
+	if err := e.EncodeBool(o.Limit != nil); err != nil {
+		return err
+	}
+
+	if o.Limit != nil {
+		v5, err := mtgpack.ConvertInt[uint32](*o.Limit)
+		if err != nil {
+			return err
+		}
+
+		if err := e.EncodeUint32(v5); err != nil {
+			return err
+		}
+	}
+
+	if err := e.EncodeBool(o.Weights != nil); err != nil {
+		return err
+	}
+
+	if o.Weights != nil {
+		if err := mtgpack.EncodeMap[uuid.UUID, decimal.Decimal](e, o.Weights, 0, func(e *mtgpack.Encoder, v6 uuid.UUID) error {
+			if err := e.EncodeUUID(v6); err != nil {
+				return err
+			}
+
+			return nil
+		}, func(e *mtgpack.Encoder, v7 decimal.Decimal) error {
+			if err := e.EncodeDecimal(v7); err != nil {
+				return err
+			}
+
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+
+	if err := mtgpack.EncodeMap[string, []Side](e, o.Labels, mtgpack.LenUint8, func(e *mtgpack.Encoder, v8 string) error {
+		if err := e.EncodeString(v8); err != nil {
+			return err
+		}
+
+		return nil
+	}, func(e *mtgpack.Encoder, v9 []Side) error {
+		if err := e.EncodeLen(len(v9), 0); err != nil {
+			return err
+		}
+
+		for i10 := range v9 {
+			if err := e.EncodeUint8(uint8(v9[i10])); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if err := e.EncodeLen(len(o.Routes), 0); err != nil {
+		return err
+	}
+
+	for i11 := range o.Routes {
+		if err := e.EncodeLen(len(o.Routes[i11]), 0); err != nil {
+			return err
+		}
+
+		for i12 := range o.Routes[i11] {
+			if err := e.EncodeUUID(o.Routes[i11][i12]); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := mtgpack.EncodeValue(e, o.Fallback); err != nil {
+		return err
+	}
+
+	if err := e.EncodeBool(o.Approved); err != nil {
+		return err
+	}
+
+	if o.Approved {
+		if err := e.EncodeBool(o.Approved); err != nil {
+			return err
+		}
+	}
+
+	if err := e.EncodeBytes(o.Signature); err != nil {
+		return err
+	}
+
+	if err := e.EncodeBool(o.Supply != nil); err != nil {
+		return err
+	}
+
+	if o.Supply != nil {
+		if err := e.EncodeBigInt(o.Supply); err != nil {
+			return err
+		}
+	}
+
+	if err := e.EncodeBigDecimal(o.Volume); err != nil {
+		return err
+	}
+
+	if err := e.EncodeBool(!o.Expiry.IsZero()); err != nil {
+		return err
+	}
+
+	if !o.Expiry.IsZero() {
+		v13, err := e.TimeToUnix(o.Expiry, mtgpack.TimeUnix)
+		if err != nil {
+			return err
+		}
+
+		v14, err := mtgpack.ConvertInt[uint32](v13)
+		if err != nil {
+			return err
+		}
+
+		if err := e.EncodeUint32(v14); err != nil {
+			return err
+		}
+	}
+
+	v15, err := e.TimeToUnix(o.Created, mtgpack.TimeUnixMilli)
+	if err != nil {
+		return err
+	}
+
+	if err := e.EncodeVarint(v15); err != nil {
+		return err
+	}
+
+	if err := e.EncodeBool(o.Settled != nil); err != nil {
+		return err
+	}
+
+	if o.Settled != nil {
+		if err := e.EncodeTimeUnit(*o.Settled, mtgpack.TimeUnix); err != nil {
+			return err
+		}
+	}
+
+	if err := e.EncodeBool(o.Action != nil); err != nil {
+		return err
+	}
+
+	if o.Action != nil {
+		if err := mtgpack.EncodeUnion[Action](e, o.Action); err != nil {
+			return err
+		}
+	}
+
+	if err := e.EncodeBinary(&o.Version); err != nil {
+		return err
+	}
+
+	if err := e.EncodeBool(o.Minimum != nil); err != nil {
+		return err
+	}
+
+	if o.Minimum != nil {
+		if err := e.EncodeBinaryLen(o.Minimum, mtgpack.LenUint16); err != nil {
+			return err
+		}
+	}
+
+	if err := e.EncodeText(&o.Release); err != nil {
+		return err
+	}
+
+	if err := e.EncodeTextLen(&o.Peer, mtgpack.LenUint8); err != nil {
+		return err
+	}
+
+	if err := e.EncodeText(&o.Ref); err != nil {
+		return err
+	}
+
+	if err := o.Rebate.EncodeMtg(e); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (o *Order) DecodeMtg(d *mtgpack.Decoder) error {
+	var err error
+
+	d.EnterField("ID")
+	if o.ID, err = d.DecodeUUID(); err != nil {
+		return err
+	}
+
+	d.Exit()
+
+	d.EnterField("FollowID")
+	offset1 := d.Offset()
+	var ok2 bool
+	if ok2, err = d.DecodeBool(); err != nil {
+		return err
+	}
+
+	if ok2 {
+		if o.FollowID, err = d.DecodeUUID(); err != nil {
+			return err
+		}
+
+		if err = d.CheckOptional(offset1, o.FollowID != (uuid.UUID{})); err != nil {
+			return err
+		}
+	} else {
+		o.FollowID = uuid.UUID{}
+	}
+
+	d.Exit()
+
+	d.EnterField("Side")
+	var v3 uint8
+	if v3, err = d.DecodeUint8(); err != nil {
+		return err
+	}
+
+	o.Side = Side(v3)
+
+	d.Exit()
+
+	d.EnterField("Count")
+	var v4 uint16
+	if v4, err = d.DecodeUint16(); err != nil {
+		return err
+	}
+
+	if o.Count, err = mtgpack.ConvertInt[int](v4); err != nil {
+		return err
+	}
+
+	d.Exit()
+
+	d.EnterField("Nonce")
+	if o.Nonce, err = d.DecodeUvarint(); err != nil {
+		return err
+	}
+
+	d.Exit()
+
+	d.EnterField("Offset")
+	var v5 int16
+	var v6 int64
+	if v6, err = d.DecodeVarint(); err != nil {
+		return err
+	}
+
+	if v5, err = mtgpack.ConvertInt[int16](v6); err != nil {
+		return err
+	}
+
+	if o.Offset, err = mtgpack.ConvertInt[int32](v5); err != nil {
+		return err
+	}
+
+	d.Exit()
+
+	d.EnterField("Price")
+	offset7 := d.Offset()
+	var ok8 bool
+	if ok8, err = d.DecodeBool(); err != nil {
+		return err
+	}
+
+	if ok8 {
+		if o.Price, err = d.DecodeDecimal(); err != nil {
+			return err
+		}
+
+		if err = d.CheckOptional(offset7, !o.Price.IsZero()); err != nil {
+			return err
+		}
+	} else {
+		o.Price = decimal.Decimal{}
+	}
+
+	d.Exit()
+
+	d.EnterField("Rate")
+	offset9 := d.Offset()
+	var ok10 bool
+	if ok10, err = d.DecodeBool(); err != nil {
+		return err
+	}
+
+	if ok10 {
+		if o.Rate, err = d.DecodeFloat64(); err != nil {
+			return err
+		}
+
+		if err = d.CheckOptional(offset9, math.Float64bits(o.Rate) != 0); err != nil {
+			return err
+		}
+	} else {
+		o.Rate = 0
+	}
+
+	d.Exit()
+
+	d.EnterField("Ratio")
+	offset11 := d.Offset()
+	var ok12 bool
+	if ok12, err = d.DecodeBool(); err != nil {
+		return err
+	}
+
+	if ok12 {
+		if o.Ratio, err = d.DecodeFloat32(); err != nil {
+			return err
+		}
+
+		if err = d.CheckOptional(offset11, math.Float32bits(o.Ratio) != 0); err != nil {
+			return err
+		}
+	} else {
+		o.Ratio = 0
+	}
+
+	d.Exit()
+
+	d.EnterField("Deadline")
+	offset13 := d.Offset()
+	var ok14 bool
+	if ok14, err = d.DecodeBool(); err != nil {
+		return err
+	}
+
+	if ok14 {
+		if o.Deadline, err = d.DecodeTime(); err != nil {
+			return err
+		}
+
+		if err = d.CheckOptional(offset13, !o.Deadline.IsZero()); err != nil {
+			return err
+		}
+	} else {
+		o.Deadline = time.Time{}
+	}
+
+	d.Exit()
+
+	d.EnterField("Memo")
+	if o.Memo, err = d.DecodeStringLen(mtgpack.LenUint16); err != nil {
+		return err
+	}
+
+	d.Exit()
+
+	d.EnterField("Extra")
+	if o.Extra, err = d.DecodeBytesLen(mtgpack.LenUvarint); err != nil {
+		return err
+	}
+
+	d.Exit()
+
+	d.EnterField("Asset")
+	offset15 := d.Offset()
+	var ok16 bool
+	if ok16, err = d.DecodeBool(); err != nil {
+		return err
+	}
+
+	if ok16 {
+		if err = d.ReadFull(o.Asset[:]); err != nil {
+			return err
+		}
+
+		if err = d.CheckOptional(offset15, o.Asset != (AssetID{})); err != nil {
+			return err
+		}
+	} else {
+		o.Asset = AssetID{}
+	}
+
+	d.Exit()
+
+	d.EnterField("Hash")
+	offset17 := d.Offset()
+	var ok18 bool
+	if ok18, err = d.DecodeBool(); err != nil {
+		return err
+	}
+
+	if ok18 {
+		if err = d.ReadFull(o.Hash[:]); err != nil {
+			return err
+		}
+
+		if err = d.CheckOptional(offset17, o.Hash != ([4]byte{})); err != nil {
+			return err
+		}
+	} else {
+		o.Hash = [4]byte{}
+	}
+
+	d.Exit()
+
+	d.EnterField("Quotes")
+	offset19 := d.Offset()
+	var ok20 bool
+	if ok20, err = d.DecodeBool(); err != nil {
+		return err
+	}
+
+	if ok20 {
+		for i21 := range o.Quotes {
+			d.EnterIndex(i21)
+			if o.Quotes[i21], err = d.DecodeUint16(); err != nil {
+				return err
+			}
+
+			d.Exit()
+		}
+
+		if err = d.CheckOptional(offset19, o.Quotes != ([2]uint16{})); err != nil {
+			return err
+		}
+	} else {
+		o.Quotes = [2]uint16{}
+	}
+
+	d.Exit()
+
+	d.EnterField("Legs")
+	var n22 int
+	if n22, err = d.DecodeLen(mtgpack.LenUint16); err != nil {
+		return err
+	}
+
+	if o.Legs, err = mtgpack.MakeSlice[[]Leg](d, o.Legs, n22); err != nil {
+		return err
+	}
+
+	for i23 := 0; i23 < n22; i23++ {
+		o.Legs = append(o.Legs, Leg{})
+		d.EnterIndex(i23)
+		if err = o.Legs[i23].DecodeMtg(d); err != nil {
+			return err
+		}
+
+		d.Exit()
+	}
+
+	d.Exit()
+
+	d.EnterField("Refund")
+	var ok24 bool
+	if ok24, err = d.DecodeBool(); err != nil {
+		return err
+	}
+
+	if ok24 {
+		if o.Refund == nil {
+			o.Refund = new(Leg)
+		}
+
+		if err = o.Refund.DecodeMtg(d); err != nil {
+			return err
+		}
+	} else {
+		o.Refund = nil
+	}
+
+	d.Exit()
+
+	d.EnterField("Limit")
+	var ok25 bool
+	if ok25, err = d.DecodeBool(); err != nil {
+		return err
+	}
+
+	if ok25 {
+		if o.Limit == nil {
+			o.Limit = new(int64)
+		}
+
+		var v26 uint32
+		if v26, err = d.DecodeUint32(); err != nil {
+			return err
+		}
+
+		if *o.Limit, err = mtgpack.ConvertInt[int64](v26); err != nil {
+			return err
+		}
+	} else {
+		o.Limit = nil
+	}
+
+	d.Exit()
+
+	d.EnterField("Weights")
+	offset27 := d.Offset()
+	var ok28 bool
+	if ok28, err = d.DecodeBool(); err != nil {
+		return err
+	}
+
+	if ok28 {
+		if o.Weights, err = mtgpack.DecodeMap[uuid.UUID, decimal.Decimal](d, 0, func(d *mtgpack.Decoder, v29 *uuid.UUID) error {
+			var err error
+
+			if *v29, err = d.DecodeUUID(); err != nil {
+				return err
+			}
+
+			return nil
+		}, func(d *mtgpack.Decoder, v30 *decimal.Decimal) error {
+			var err error
+
+			if *v30, err = d.DecodeDecimal(); err != nil {
+				return err
+			}
+
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		if err = d.CheckOptional(offset27, o.Weights != nil); err != nil {
+			return err
+		}
+	} else {
+		o.Weights = nil
+	}
+
+	d.Exit()
+
+	d.EnterField("Labels")
+	if o.Labels, err = mtgpack.DecodeMap[string, []Side](d, mtgpack.LenUint8, func(d *mtgpack.Decoder, v31 *string) error {
+		var err error
+
+		if *v31, err = d.DecodeString(); err != nil {
+			return err
+		}
+
+		return nil
+	}, func(d *mtgpack.Decoder, v32 *[]Side) error {
+		var err error
+
+		var n33 int
+		if n33, err = d.DecodeLen(0); err != nil {
+			return err
+		}
+
+		if *v32, err = mtgpack.MakeSlice[[]Side](d, *v32, n33); err != nil {
+			return err
+		}
+
+		for i34 := 0; i34 < n33; i34++ {
+			*v32 = append(*v32, 0)
+			d.EnterIndex(i34)
+			var v35 uint8
+			if v35, err = d.DecodeUint8(); err != nil {
+				return err
+			}
+
+			(*v32)[i34] = Side(v35)
+
+			d.Exit()
+		}
+
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	d.Exit()
+
+	d.EnterField("Routes")
+	var n36 int
+	if n36, err = d.DecodeLen(0); err != nil {
+		return err
+	}
+
+	if o.Routes, err = mtgpack.MakeSlice[[][]uuid.UUID](d, o.Routes, n36); err != nil {
+		return err
+	}
+
+	for i37 := 0; i37 < n36; i37++ {
+		o.Routes = append(o.Routes, nil)
+		d.EnterIndex(i37)
+		var n38 int
+		if n38, err = d.DecodeLen(0); err != nil {
+			return err
+		}
+
+		if o.Routes[i37], err = mtgpack.MakeSlice[[]uuid.UUID](d, o.Routes[i37], n38); err != nil {
+			return err
+		}
+
+		for i39 := 0; i39 < n38; i39++ {
+			o.Routes[i37] = append(o.Routes[i37], uuid.UUID{})
+			d.EnterIndex(i39)
+			if o.Routes[i37][i39], err = d.DecodeUUID(); err != nil {
+				return err
+			}
+
+			d.Exit()
+		}
+
+		d.Exit()
+	}
+
+	d.Exit()
+
+	d.EnterField("Fallback")
+	if err = mtgpack.DecodeValue(d, &o.Fallback); err != nil {
+		return err
+	}
+
+	d.Exit()
+
+	d.EnterField("Approved")
+	offset40 := d.Offset()
+	var ok41 bool
+	if ok41, err = d.DecodeBool(); err != nil {
+		return err
+	}
+
+	if ok41 {
+		if o.Approved, err = d.DecodeBool(); err != nil {
+			return err
+		}
+
+		if err = d.CheckOptional(offset40, o.Approved); err != nil {
+			return err
+		}
+	} else {
+		o.Approved = false
+	}
+
+	d.Exit()
+
+	d.EnterField("Signature")
+	if o.Signature, err = d.DecodeBytes(); err != nil {
+		return err
+	}
+
+	d.Exit()
+
+	d.EnterField("Supply")
+	var ok42 bool
+	if ok42, err = d.DecodeBool(); err != nil {
+		return err
+	}
+
+	if ok42 {
+		if o.Supply == nil {
+			o.Supply = new(big.Int)
+		}
+
+		var x43 *big.Int
+		if x43, err = d.DecodeBigInt(); err != nil {
+			return err
+		}
+		o.Supply.Set(x43)
+	} else {
+		o.Supply = nil
+	}
+
+	d.Exit()
+
+	d.EnterField("Volume")
+	if o.Volume, err = d.DecodeBigDecimal(); err != nil {
+		return err
+	}
+
+	d.Exit()
+
+	d.EnterField("Expiry")
+	offset44 := d.Offset()
+	var ok45 bool
+	if ok45, err = d.DecodeBool(); err != nil {
+		return err
+	}
+
+	if ok45 {
+		var v46 int64
+		var v47 uint32
+		if v47, err = d.DecodeUint32(); err != nil {
+			return err
+		}
+
+		if v46, err = mtgpack.ConvertInt[int64](v47); err != nil {
+			return err
+		}
+
+		o.Expiry = d.TimeFromUnix(v46, mtgpack.TimeUnix)
+		o.Expiry = o.Expiry.UTC()
+
+		if err = d.CheckOptional(offset44, !o.Expiry.IsZero()); err != nil {
+			return err
+		}
+	} else {
+		o.Expiry = time.Time{}
+	}
+
+	d.Exit()
+
+	d.EnterField("Created")
+	var v48 int64
+	if v48, err = d.DecodeVarint(); err != nil {
+		return err
+	}
+
+	o.Created = d.TimeFromUnix(v48, mtgpack.TimeUnixMilli)
+
+	d.Exit()
+
+	d.EnterField("Settled")
+	var ok49 bool
+	if ok49, err = d.DecodeBool(); err != nil {
+		return err
+	}
+
+	if ok49 {
+		if o.Settled == nil {
+			o.Settled = new(time.Time)
+		}
+
+		if *o.Settled, err = d.DecodeTimeUnit(mtgpack.TimeUnix); err != nil {
+			return err
+		}
+	} else {
+		o.Settled = nil
+	}
+
+	d.Exit()
+
+	d.EnterField("Action")
+	offset50 := d.Offset()
+	var ok51 bool
+	if ok51, err = d.DecodeBool(); err != nil {
+		return err
+	}
+
+	if ok51 {
+		if o.Action, err = mtgpack.DecodeUnion[Action](d); err != nil {
+			return err
+		}
+
+		if err = d.CheckOptional(offset50, o.Action != nil); err != nil {
+			return err
+		}
+	} else {
+		o.Action = nil
+	}
+
+	d.Exit()
+
+	d.EnterField("Version")
+	if err = d.DecodeBinary(&o.Version); err != nil {
+		return err
+	}
+
+	d.Exit()
+
+	d.EnterField("Minimum")
+	var ok52 bool
+	if ok52, err = d.DecodeBool(); err != nil {
+		return err
+	}
+
+	if ok52 {
+		if o.Minimum == nil {
+			o.Minimum = new(Version)
+		}
+
+		if err = d.DecodeBinaryLen(o.Minimum, mtgpack.LenUint16); err != nil {
+			return err
+		}
+	} else {
+		o.Minimum = nil
+	}
+
+	d.Exit()
+
+	d.EnterField("Release")
+	if err = d.DecodeText(&o.Release); err != nil {
+		return err
+	}
+
+	d.Exit()
+
+	d.EnterField("Peer")
+	if err = d.DecodeTextLen(&o.Peer, mtgpack.LenUint8); err != nil {
+		return err
+	}
+
+	d.Exit()
+
+	d.EnterField("Ref")
+	if err = d.DecodeText(&o.Ref); err != nil {
+		return err
+	}
+
+	d.Exit()
+
+	d.EnterField("Rebate")
+	if err = o.Rebate.DecodeMtg(d); err != nil {
+		return err
+	}
+
+	d.Exit()
+
+	return nil
+}
+
+func (l Leg) EncodeMtg(e *mtgpack.Encoder) error {
+	if err := e.EncodeUUID(l.Asset); err != nil {
+		return err
+	}
+
+	if err := e.EncodeDecimal(l.Amount); err != nil {
+		return err
+	}
+
+	if err := e.EncodeBool(l.Tag != nil); err != nil {
+		return err
+	}
+
+	if l.Tag != nil {
+		if err := e.EncodeString(*l.Tag); err != nil {
+			return err
+		}
+	}
+
+	if err := e.EncodeBool(l.Fee != nil); err != nil {
+		return err
+	}
+
+	if l.Fee != nil {
+		if err := e.EncodeDecimalPrec(*l.Fee, 18); err != nil {
+			return err
+		}
+	}
+
+	if err := e.EncodeBigInt(&l.Raw); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (l *Leg) DecodeMtg(d *mtgpack.Decoder) error {
+	var err error
+
+	d.EnterField("Asset")
+	if l.Asset, err = d.DecodeUUID(); err != nil {
+		return err
+	}
+
+	d.Exit()
+
+	d.EnterField("Amount")
+	if l.Amount, err = d.DecodeDecimal(); err != nil {
+		return err
+	}
+
+	d.Exit()
+
+	d.EnterField("Tag")
+	var ok1 bool
+	if ok1, err = d.DecodeBool(); err != nil {
+		return err
+	}
+
+	if ok1 {
+		if l.Tag == nil {
+			l.Tag = new(string)
+		}
+
+		if *l.Tag, err = d.DecodeString(); err != nil {
+			return err
+		}
+	} else {
+		l.Tag = nil
+	}
+
+	d.Exit()
+
+	d.EnterField("Fee")
+	var ok2 bool
+	if ok2, err = d.DecodeBool(); err != nil {
+		return err
+	}
+
+	if ok2 {
+		if l.Fee == nil {
+			l.Fee = new(decimal.Decimal)
+		}
+
+		if *l.Fee, err = d.DecodeDecimalPrec(18); err != nil {
+			return err
+		}
+	} else {
+		l.Fee = nil
+	}
+
+	d.Exit()
+
+	d.EnterField("Raw")
+	var x3 *big.Int
+	if x3, err = d.DecodeBigInt(); err != nil {
+		return err
+	}
+	l.Raw.Set(x3)
+
+	d.Exit()
+
+	return nil
+}
+
+func (n Node) EncodeMtg(e *mtgpack.Encoder) error {
+	if err := e.EncodeUint8(n.Value); err != nil {
+		return err
+	}
+
+	if err := e.EncodeBool(n.Next != nil); err != nil {
+		return err
+	}
+
+	if n.Next != nil {
+		if err := n.Next.EncodeMtg(e); err != nil {
+			return err
+		}
+	}
+
+	if err := e.EncodeLen(len(n.Children), 0); err != nil {
+		return err
+	}
+
+	for i1 := range n.Children {
+		if err := n.Children[i1].EncodeMtg(e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (n *Node) DecodeMtg(d *mtgpack.Decoder) error {
+	var err error
+
+	d.EnterField("Value")
+	if n.Value, err = d.DecodeUint8(); err != nil {
+		return err
+	}
+
+	d.Exit()
+
+	d.EnterField("Next")
+	var ok1 bool
+	if ok1, err = d.DecodeBool(); err != nil {
+		return err
+	}
+
+	if ok1 {
+		if n.Next == nil {
+			n.Next = new(Node)
+		}
+
+		if err = n.Next.DecodeMtg(d); err != nil {
+			return err
+		}
+	} else {
+		n.Next = nil
+	}
+
+	d.Exit()
+
+	d.EnterField("Children")
+	var n2 int
+	if n2, err = d.DecodeLen(0); err != nil {
+		return err
+	}
+
+	if n.Children, err = mtgpack.MakeSlice[[]Node](d, n.Children, n2); err != nil {
+		return err
+	}
+
+	for i3 := 0; i3 < n2; i3++ {
+		n.Children = append(n.Children, Node{})
+		d.EnterIndex(i3)
+		if err = n.Children[i3].DecodeMtg(d); err != nil {
+			return err
+		}
+
+		d.Exit()
+	}
+
+	d.Exit()
+
+	return nil
+}
@@ -0,0 +1,87 @@
+// Command mtgpackgen generates EncodeMtg and DecodeMtg methods for struct types.
+//
+// The generated methods encode the exported fields of a struct in declaration
+// order, honoring their `mtg` tags, and produce exactly the same bytes as
+// mtgpack.EncodeValue and mtgpack.DecodeValue without using reflection. Usage:
+//
+//	mtgpackgen -type Header,Order [-output file] [dir]
+//
+// It is meant to be run by go generate, with a comment like
+//
+//	//go:generate go run github.com/pandodao/mtg/cmd/mtgpackgen -type Header
+//
+// in the package that declares the types. The methods are written to
+// <type>_mtgpack.go, named after the first type, in the package directory.
+//
+// Fields whose types are declared in the same package are encoded by calling
+// their EncodeMtg and DecodeMtg methods, so the types they refer to should be
+// generated too. Fields of struct types without these methods, and of types from
+// other packages except uuid.UUID, decimal.Decimal, time.Time and big.Int, fall
+// back to mtgpack.EncodeValue and mtgpack.DecodeValue. Fields of interface types
+// declared in the package are encoded as unions, see mtgpack.RegisterUnion;
+// interface types of other packages are not recognized as such.
+//
+// Types declared in the package with MarshalBinary and UnmarshalBinary methods
+// are encoded with them, like in mtgpack.EncodeValue. Fields of types from other
+// packages tagged with a length prefix are assumed to implement these methods.
+// The encodings of uuid.UUID, decimal.Decimal, time.Time and big.Int are built
+// into the generated code, so replacing them with mtgpack.RegisterType does not
+// affect it, while the types of other packages follow the registry of the
+// Encoder or Decoder.
+//
+// The generated DecodeMtg methods name the fields and elements they decode with
+// mtgpack.Decoder.EnterField and EnterIndex, for the paths of errors and traces.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	typeNames = flag.String("type", "", "comma-separated list of type names, must be set")
+	output    = flag.String("output", "", "output file name, default <dir>/<type>_mtgpack.go")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage of mtgpackgen:\n")
+	fmt.Fprintf(os.Stderr, "\tmtgpackgen -type T,U [-output file] [dir]\n")
+	fmt.Fprintf(os.Stderr, "Flags:\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("mtgpackgen: ")
+
+	flag.Usage = usage
+	flag.Parse()
+	if *typeNames == "" || flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	dir := "."
+	if flag.NArg() == 1 {
+		dir = flag.Arg(0)
+	}
+
+	types := strings.Split(*typeNames, ",")
+	src, err := Generate(dir, types)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	name := *output
+	if name == "" {
+		name = filepath.Join(dir, strings.ToLower(types[0])+"_mtgpack.go")
+	}
+
+	if err := os.WriteFile(name, src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
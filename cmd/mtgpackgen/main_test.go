@@ -0,0 +1,119 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGenerate checks that the generated files in the repository are up to date.
+func TestGenerate(t *testing.T) {
+	cases := []struct {
+		dir    string
+		types  []string
+		output string
+	}{
+		{dir: "internal/example", types: []string{"Order", "Leg", "Node"}, output: "order_mtgpack.go"},
+		{dir: "../../protocol", types: []string{"Header"}, output: "header_mtgpack.go"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.output, func(t *testing.T) {
+			got, err := Generate(c.dir, c.types)
+			require.NoError(t, err)
+
+			want, err := os.ReadFile(filepath.Join(c.dir, c.output))
+			require.NoError(t, err)
+			assert.Equal(t, string(want), string(got), "run go generate to update %s", c.output)
+		})
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		src  string
+		typ  string
+		want string
+	}{
+		{
+			name: "not found",
+			src:  "package p\n",
+			typ:  "T",
+			want: "type T not found",
+		},
+		{
+			name: "not a struct",
+			src:  "package p\n\ntype T uint8\n",
+			typ:  "T",
+			want: "type T is not a struct type",
+		},
+		{
+			name: "unknown option",
+			src:  "package p\n\ntype T struct {\n\tA uint8 `mtg:\",packed\"`\n}\n",
+			typ:  "T",
+			want: `invalid mtg tag on T.A: unknown option "packed"`,
+		},
+		{
+			name: "precision out of range",
+			src:  "package p\n\nimport \"github.com/shopspring/decimal\"\n\ntype T struct {\n\tA decimal.Decimal `mtg:\",prec=19\"`\n}\n",
+			typ:  "T",
+			want: `invalid mtg tag on T.A: invalid decimal precision "19"`,
+		},
+		{
+			name: "precision on int",
+			src:  "package p\n\ntype T struct {\n\tA int64 `mtg:\",prec=8\"`\n}\n",
+			typ:  "T",
+			want: `invalid mtg tag on T.A: option "prec=8" cannot be applied to int64`,
+		},
+		{
+			name: "big on int",
+			src:  "package p\n\ntype T struct {\n\tA int64 `mtg:\",big\"`\n}\n",
+			typ:  "T",
+			want: `invalid mtg tag on T.A: option "big" cannot be applied to int64`,
+		},
+		{
+			name: "override on string",
+			src:  "package p\n\ntype T struct {\n\tA string `mtg:\"uint8\"`\n}\n",
+			typ:  "T",
+			want: `invalid mtg tag on T.A: type "uint8" cannot be applied to string`,
+		},
+		{
+			name: "text on int",
+			src:  "package p\n\ntype T struct {\n\tA int64 `mtg:\",text\"`\n}\n",
+			typ:  "T",
+			want: `invalid mtg tag on T.A: option "text" cannot be applied to int64`,
+		},
+		{
+			name: "length prefix on struct",
+			src:  "package p\n\ntype T struct {\n\tA S `mtg:\",len=uint16\"`\n}\n\ntype S struct{}\n",
+			typ:  "T",
+			want: `invalid mtg tag on T.A: option "len" cannot be applied to S`,
+		},
+		{
+			name: "length prefix on marshal only",
+			src:  "package p\n\ntype T struct {\n\tA S `mtg:\",len=uint16\"`\n}\n\ntype S struct{}\n\nfunc (S) MarshalBinary() ([]byte, error) { return nil, nil }\n",
+			typ:  "T",
+			want: `invalid mtg tag on T.A: option "len" cannot be applied to S`,
+		},
+		{
+			name: "interface",
+			src:  "package p\n\ntype T struct {\n\tA interface{}\n}\n",
+			typ:  "T",
+			want: "T.A: unsupported type interface{}",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "p.go"), []byte(c.src), 0o644))
+
+			_, err := Generate(dir, []string{c.typ})
+			assert.EqualError(t, err, c.want)
+		})
+	}
+}
@@ -0,0 +1,235 @@
+package mtgpack
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// The Append functions append the encoding of a value to dst and return the
+// extended buffer, like the Append functions of the strconv package. They
+// produce the same bytes as the Encoder methods with the default options, and
+// let callers encode into preallocated or pooled buffers without an Encoder.
+
+// AppendInt8 appends the given int8 as a uint8.
+func AppendInt8(dst []byte, x int8) []byte {
+	return AppendUint8(dst, uint8(x))
+}
+
+// AppendInt16 appends the given int16 as a uint16.
+func AppendInt16(dst []byte, x int16) []byte {
+	return AppendUint16(dst, uint16(x))
+}
+
+// AppendInt32 appends the given int32 as a uint32.
+func AppendInt32(dst []byte, x int32) []byte {
+	return AppendUint32(dst, uint32(x))
+}
+
+// AppendInt64 appends the given int64 as a uint64.
+func AppendInt64(dst []byte, x int64) []byte {
+	return AppendUint64(dst, uint64(x))
+}
+
+// AppendUint8 appends the given uint8.
+func AppendUint8(dst []byte, x uint8) []byte {
+	return append(dst, x)
+}
+
+// AppendUint16 appends the given uint16 in big-endian format.
+func AppendUint16(dst []byte, x uint16) []byte {
+	return append(dst, byte(x>>8), byte(x))
+}
+
+// AppendUint32 appends the given uint32 in big-endian format.
+func AppendUint32(dst []byte, x uint32) []byte {
+	return append(dst, byte(x>>24), byte(x>>16), byte(x>>8), byte(x))
+}
+
+// AppendUint64 appends the given uint64 in big-endian format.
+func AppendUint64(dst []byte, x uint64) []byte {
+	return append(dst,
+		byte(x>>56), byte(x>>48), byte(x>>40), byte(x>>32),
+		byte(x>>24), byte(x>>16), byte(x>>8), byte(x),
+	)
+}
+
+// AppendVarint appends the given int64 as a zigzag encoded varint.
+func AppendVarint(dst []byte, x int64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(b[:], x)
+	return append(dst, b[:n]...)
+}
+
+// AppendUvarint appends the given uint64 as a varint.
+func AppendUvarint(dst []byte, x uint64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], x)
+	return append(dst, b[:n]...)
+}
+
+// AppendFloat32 appends the given float32 in IEEE 754 binary format. Unlike a
+// strict Encoder, it does not reject NaN and infinities.
+func AppendFloat32(dst []byte, x float32) []byte {
+	return AppendUint32(dst, math.Float32bits(x))
+}
+
+// AppendFloat64 appends the given float64 in IEEE 754 binary format. Unlike a
+// strict Encoder, it does not reject NaN and infinities.
+func AppendFloat64(dst []byte, x float64) []byte {
+	return AppendUint64(dst, math.Float64bits(x))
+}
+
+// AppendBool appends the given bool as a single byte (1 for true, 0 for false).
+func AppendBool(dst []byte, b bool) []byte {
+	if b {
+		return append(dst, 1)
+	}
+
+	return append(dst, 0)
+}
+
+// AppendUUID appends the 16 bytes of the given UUID.
+func AppendUUID(dst []byte, x uuid.UUID) []byte {
+	return append(dst, x[:]...)
+}
+
+// AppendDecimal appends the given decimal shifted by fixedDecimalPrecision, as an int64.
+func AppendDecimal(dst []byte, d decimal.Decimal) []byte {
+	return AppendDecimalPrec(dst, d, fixedDecimalPrecision)
+}
+
+// AppendDecimalPrec appends the given decimal shifted by prec, as an int64.
+// Like a non-strict Encoder, it truncates digits beyond the precision.
+func AppendDecimalPrec(dst []byte, d decimal.Decimal, prec int32) []byte {
+	return AppendInt64(dst, d.Shift(prec).IntPart())
+}
+
+// AppendBigDecimal appends the coefficient of the given decimal like AppendBigInt,
+// followed by its exponent as a zigzag varint.
+func AppendBigDecimal(dst []byte, d decimal.Decimal) ([]byte, error) {
+	dst, err := AppendBigInt(dst, d.Coefficient())
+	if err != nil {
+		return dst, err
+	}
+
+	return AppendVarint(dst, int64(d.Exponent())), nil
+}
+
+// AppendBigInt appends a sign byte, 1 if the given integer is negative and 0
+// otherwise, followed by its absolute value in big-endian format like AppendBytes.
+func AppendBigInt(dst []byte, x *big.Int) ([]byte, error) {
+	if x == nil {
+		return dst, fmt.Errorf("nil pointer: %T", x)
+	}
+
+	var sign uint8
+	if x.Sign() < 0 {
+		sign = 1
+	}
+
+	var b [32]byte
+	buf, err := AppendBytes(AppendUint8(dst, sign), bigIntBytes(x, b[:]))
+	if err != nil {
+		return dst, err
+	}
+
+	return buf, nil
+}
+
+// AppendTime appends the given time as an int64 representing the number of
+// nanoseconds elapsed since January 1, 1970 UTC.
+func AppendTime(dst []byte, t time.Time) []byte {
+	return AppendInt64(dst, t.UnixNano())
+}
+
+// AppendLen appends the given length as an integer of the length prefix p,
+// LenUint8 if p is zero. It returns ErrTooLong if the length does not fit in
+// the prefix.
+func AppendLen(dst []byte, l int, p LenPrefix) ([]byte, error) {
+	switch p {
+	case LenUint16:
+		if l > math.MaxUint16 {
+			return dst, fmt.Errorf("%w: length %d exceeds %s prefix", ErrTooLong, l, p)
+		}
+
+		return AppendUint16(dst, uint16(l)), nil
+	case LenUint32:
+		if uint64(l) > math.MaxUint32 {
+			return dst, fmt.Errorf("%w: length %d exceeds %s prefix", ErrTooLong, l, p)
+		}
+
+		return AppendUint32(dst, uint32(l)), nil
+	case LenUvarint:
+		return AppendUvarint(dst, uint64(l)), nil
+	default:
+		if l > math.MaxUint8 {
+			return dst, fmt.Errorf("%w: length %d exceeds %s prefix", ErrTooLong, l, LenUint8)
+		}
+
+		return AppendUint8(dst, uint8(l)), nil
+	}
+}
+
+// AppendBytes appends the length of the given byte slice as a uint8, followed
+// by the slice bytes.
+func AppendBytes(dst, b []byte) ([]byte, error) {
+	return AppendBytesLen(dst, b, 0)
+}
+
+// AppendBytesLen appends the given byte slice like AppendBytes, with its length
+// encoded as an integer of the length prefix p.
+func AppendBytesLen(dst, b []byte, p LenPrefix) ([]byte, error) {
+	dst, err := AppendLen(dst, len(b), p)
+	if err != nil {
+		return dst, err
+	}
+
+	return append(dst, b...), nil
+}
+
+// AppendString appends the given string like AppendBytes.
+func AppendString(dst []byte, s string) ([]byte, error) {
+	return AppendBytesLen(dst, stringToBytes(s), 0)
+}
+
+// AppendStringLen appends the given string like AppendBytesLen.
+func AppendStringLen(dst []byte, s string, p LenPrefix) ([]byte, error) {
+	return AppendBytesLen(dst, stringToBytes(s), p)
+}
+
+// maxPooledEncoderSize is the largest buffer an Encoder may have to be put back
+// in encoderPool, so that one large value does not pin its memory forever.
+const maxPooledEncoderSize = 64 << 10
+
+// encoderPool holds the Encoders used by AppendValue.
+var encoderPool = sync.Pool{
+	New: func() interface{} {
+		return NewEncoder()
+	},
+}
+
+// AppendValue appends the encoding of v, as encoded by EncodeValue with the
+// default options. The Encoder it uses is taken from a pool, so once warmed up,
+// appending a value to a buffer with enough capacity does not allocate unless
+// encoding the value itself does. On error, dst is returned unchanged.
+func AppendValue(dst []byte, v interface{}) ([]byte, error) {
+	e := encoderPool.Get().(*Encoder)
+	err := EncodeValue(e, v)
+	if err == nil {
+		dst = append(dst, e.Bytes()...)
+	}
+
+	if e.buf.Cap() <= maxPooledEncoderSize {
+		e.Reset()
+		encoderPool.Put(e)
+	}
+
+	return dst, err
+}
@@ -0,0 +1,125 @@
+package mtgpack
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppend(t *testing.T) {
+	id := uuid.New()
+	amount := decimal.RequireFromString("12.34567891")
+	now := time.Now()
+
+	enc := NewEncoder()
+	require.NoError(t, enc.EncodeValues(
+		int8(-1), int16(-2), int32(-3), int64(-4),
+		uint8(1), uint16(2), uint32(3), uint64(4),
+		float32(1.5), 2.5, true, false,
+		id, amount, now, "xvgf", []byte{1, 2},
+	))
+	require.NoError(t, enc.EncodeVarint(-300))
+	require.NoError(t, enc.EncodeUvarint(300))
+	require.NoError(t, enc.EncodeStringLen("long", LenUint16))
+
+	b := AppendInt8(nil, -1)
+	b = AppendInt16(b, -2)
+	b = AppendInt32(b, -3)
+	b = AppendInt64(b, -4)
+	b = AppendUint8(b, 1)
+	b = AppendUint16(b, 2)
+	b = AppendUint32(b, 3)
+	b = AppendUint64(b, 4)
+	b = AppendFloat32(b, 1.5)
+	b = AppendFloat64(b, 2.5)
+	b = AppendBool(b, true)
+	b = AppendBool(b, false)
+	b = AppendUUID(b, id)
+	b = AppendDecimal(b, amount)
+	b = AppendTime(b, now)
+
+	b, err := AppendString(b, "xvgf")
+	require.NoError(t, err)
+	b, err = AppendBytes(b, []byte{1, 2})
+	require.NoError(t, err)
+
+	b = AppendVarint(b, -300)
+	b = AppendUvarint(b, 300)
+
+	b, err = AppendStringLen(b, "long", LenUint16)
+	require.NoError(t, err)
+
+	assert.Equal(t, enc.Bytes(), b)
+
+	t.Run("too long", func(t *testing.T) {
+		dst := []byte{1}
+		got, err := AppendString(dst, strings.Repeat("x", 256))
+		assert.ErrorIs(t, err, ErrTooLong)
+		assert.Equal(t, dst, got)
+
+		_, err = AppendLen(nil, 1<<16, LenUint16)
+		assert.ErrorIs(t, err, ErrTooLong)
+	})
+}
+
+func TestAppendValue(t *testing.T) {
+	x := testOrder{
+		Header: testHeader{Version: 1, Action: 3},
+		Asset:  uuid.New(),
+		Amount: decimal.NewFromFloat(1.5),
+		Route:  "xvgf",
+		Count:  2,
+	}
+
+	want, err := Marshal(x)
+	require.NoError(t, err)
+
+	prefix := []byte("memo:")
+	b, err := AppendValue(prefix, x)
+	require.NoError(t, err)
+	assert.Equal(t, append([]byte("memo:"), want...), b)
+
+	b, err = AppendValue(prefix, make(chan int))
+	assert.ErrorIs(t, err, ErrUnsupportedType)
+	assert.Equal(t, prefix, b)
+
+	t.Run("zero alloc", func(t *testing.T) {
+		header := testHeader{Version: 1, Action: 3}
+		buf := make([]byte, 0, 64)
+
+		allocs := testing.AllocsPerRun(100, func() {
+			if _, err := AppendValue(buf[:0], &header); err != nil {
+				t.Fatal(err)
+			}
+		})
+
+		assert.Zero(t, allocs)
+	})
+}
+
+func BenchmarkAppendValue(b *testing.B) {
+	x := testOrder{
+		Header: testHeader{Version: 1, Action: 3},
+		Asset:  uuid.New(),
+		Amount: decimal.NewFromFloat(1.5),
+		Route:  "xvgf",
+		Count:  2,
+	}
+
+	buf := make([]byte, 0, 128)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		var err error
+		if buf, err = AppendValue(buf[:0], &x); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
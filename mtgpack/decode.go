@@ -1,162 +1,1056 @@
 package mtgpack
 
 import (
-	"bytes"
+	"encoding"
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"io"
+	"math"
+	"math/big"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/shopspring/decimal"
 )
 
+// DecoderOptions controls how a Decoder validates its input.
+type DecoderOptions struct {
+	// Strict rejects input that is not in canonical form, that is input which
+	// would not encode back to the same bytes: map keys that are duplicated or
+	// not in ascending order, bools other than 0 and 1, varints that are not
+	// minimal, optional values that are present but zero, and NaN or infinite
+	// floats. Signatures and deduplication keyed on the encoded bytes rely on it.
+	Strict bool
+
+	// LenPrefix is the default length prefix of strings, byte slices, slices
+	// and maps, LenUint8 if not set. It must match the prefix of the Encoder.
+	LenPrefix LenPrefix
+
+	// DecimalPrecision is the default number of fractional digits of decimals,
+	// 8 if not set, at most MaxDecimalPrecision. It must match the precision of
+	// the Encoder.
+	DecimalPrecision int32
+
+	// BigDecimal decodes decimals with DecodeBigDecimal instead of as a fixed
+	// precision int64. It must match the mode of the Encoder. A few bytes can
+	// encode an exponent of millions, whose digits take as long to format, so
+	// untrusted input should be decoded with MaxDecimalExponent.
+	BigDecimal bool
+
+	// TimeUnit is the default unit of times, TimeUnixNano if not set. It must
+	// match the unit of the Encoder.
+	TimeUnit TimeUnit
+
+	// UTC sets the location of decoded times to UTC instead of the local time,
+	// so that they compare equal with == on every machine.
+	UTC bool
+
+	// MaxBytes is the maximum number of bytes read from the input, unlimited if
+	// not set. It is checked before the buffer of a byte slice or string is
+	// allocated, and slices and maps grow as their elements are decoded, so a
+	// length prefix cannot make the Decoder allocate much more. Elements of size
+	// 0, like empty structs, are not read from the input and count as one byte.
+	MaxBytes int64
+
+	// MaxCollectionLen is the maximum length of strings, byte slices, slices
+	// and maps, unlimited if not set.
+	MaxCollectionLen int
+
+	// MaxDepth is the maximum nesting depth of the struct fields, elements and
+	// map entries decoded by DecodeValue, unlimited if not set.
+	MaxDepth int
+
+	// MaxDecimalExponent is the maximum absolute exponent of the decimals
+	// decoded by DecodeBigDecimal, unlimited if not set.
+	MaxDecimalExponent int32
+
+	// ZeroCopy makes a Decoder constructed by NewDecoder return byte slices and
+	// strings that share memory with its input instead of copies, so decoding
+	// them does not allocate. The input must not be modified while they are in use.
+	ZeroCopy bool
+
+	// ReuseSlices makes DecodeValue and DecodeMtg methods decode slices into the
+	// backing array of the slice decoded into, if it is large enough, instead of
+	// a new one, so that decoding into the same value repeatedly does not
+	// allocate. Slices decoded before share the array and change too.
+	ReuseSlices bool
+}
+
+// Decoder provides methods for decoding different data types from an input,
+// either a byte slice or an io.Reader.
 type Decoder struct {
-	io.Reader
+	io.Reader // the input, nil if the Decoder reads from buf
+	buf       []byte
+	opts      DecoderOptions
+	off       int64      // number of bytes read from the input, the cursor into buf
+	path      []pathElem // path of the value being decoded, for errors
+	trace     *Trace     // records the values read, nil if not traced
+	types     *Registry  // the registered types, nil for the default Registry
+	scratch   [16]byte   // buffer for fixed size values read from Reader
+	captured  *[]byte    // the bytes read from Reader by captureRead, if not nil
 }
 
 // NewDecoder returns a new Decoder with the provided byte slice as its input.
+// The Decoder reads directly from the slice, integers are decoded without allocation.
 func NewDecoder(b []byte) *Decoder {
-	return &Decoder{Reader: bytes.NewReader(b)}
+	return &Decoder{buf: b}
+}
+
+// Reset resets the Decoder to read from the byte slice b, keeping its options.
+// It allows a Decoder to be reused for many inputs.
+func (d *Decoder) Reset(b []byte) {
+	d.Reader = nil
+	d.buf = b
+	d.off = 0
+	d.path = d.path[:0]
+}
+
+// SetOptions replaces the options of the Decoder. It returns an error, and
+// keeps the current options, if DecoderOptions.DecimalPrecision is out of range.
+func (d *Decoder) SetOptions(opts DecoderOptions) error {
+	if err := checkDecimalPrec(opts.DecimalPrecision); err != nil {
+		return err
+	}
+
+	d.opts = opts
+	return nil
+}
+
+// Options returns the options of the Decoder.
+func (d *Decoder) Options() DecoderOptions {
+	return d.opts
+}
+
+// Offset returns the number of bytes read from the input so far.
+func (d *Decoder) Offset() int64 {
+	return d.off
+}
+
+// Read implements io.Reader interface and reads from the underlying input.
+func (d *Decoder) Read(b []byte) (int, error) {
+	if d.Reader == nil {
+		if d.off >= int64(len(d.buf)) && len(b) > 0 {
+			return 0, io.EOF
+		}
+
+		n := copy(b, d.buf[d.off:])
+		d.off += int64(n)
+		return n, nil
+	}
+
+	n, err := d.Reader.Read(b)
+	d.off += int64(n)
+	if d.captured != nil {
+		*d.captured = append(*d.captured, b[:n]...)
+	}
+
+	return n, err
+}
+
+// captureRead calls read and returns the bytes of the input it consumed, for
+// example to compare encoded map keys without encoding them again.
+func (d *Decoder) captureRead(read func() error) ([]byte, error) {
+	offset := d.off
+	if d.Reader == nil {
+		err := read()
+		return d.buf[offset:d.off], err
+	}
+
+	outer := d.captured
+	var b []byte
+	d.captured = &b
+	err := read()
+	d.captured = outer
+	if outer != nil {
+		*outer = append(*outer, b...)
+	}
+
+	return b, err
+}
+
+// Remaining returns the number of bytes left in the input, or -1 if the
+// underlying reader does not report its length.
+func (d *Decoder) Remaining() int {
+	if d.Reader == nil {
+		return len(d.buf) - int(d.off)
+	}
+
+	if r, ok := d.Reader.(interface{ Len() int }); ok {
+		return r.Len()
+	}
+
+	return -1
 }
 
-// read reads from the underlying input and fills the provided byte slice.
+// next returns the next n bytes of the input. The returned slice shares memory
+// with the input or with the scratch buffer of the Decoder, so it is only valid
+// until the next read.
+func (d *Decoder) next(n int) ([]byte, error) {
+	if err := d.checkRead(n); err != nil {
+		return nil, err
+	}
+
+	if d.Reader == nil {
+		if rest := len(d.buf) - int(d.off); n > rest {
+			offset := d.off
+			d.off = int64(len(d.buf))
+			return nil, d.wrapError(offset, ErrUnexpectedEOF)
+		}
+
+		b := d.buf[d.off : d.off+int64(n)]
+		d.off += int64(n)
+		return b, nil
+	}
+
+	var b []byte
+	if n <= len(d.scratch) {
+		b = d.scratch[:n]
+	} else {
+		b = make([]byte, n)
+	}
+
+	if err := d.read(b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// read reads from the underlying input and fills the provided byte slice. It
+// returns ErrUnexpectedEOF if the input ends before the slice is filled.
 func (d *Decoder) read(b []byte) error {
-	_, err := d.Read(b)
-	return err
+	if err := d.checkRead(len(b)); err != nil {
+		return err
+	}
+
+	offset := d.off
+	_, err := io.ReadFull(d, b)
+	if err == io.EOF {
+		err = ErrUnexpectedEOF
+	}
+
+	return d.wrapError(offset, err)
+}
+
+// checkRead returns ErrLimitExceeded if reading n more bytes would exceed
+// DecoderOptions.MaxBytes, or if the value being read is nested deeper than
+// DecoderOptions.MaxDepth. The fields and elements entered by DecodeMtg methods
+// count towards the depth too, so the limit holds until they are exited.
+func (d *Decoder) checkRead(n int) error {
+	if err := d.checkDepth(d.off); err != nil {
+		return err
+	}
+
+	return d.checkMaxBytes(n)
+}
+
+// checkMaxBytes returns ErrLimitExceeded if reading n more bytes would exceed
+// DecoderOptions.MaxBytes.
+func (d *Decoder) checkMaxBytes(n int) error {
+	if max := d.opts.MaxBytes; max > 0 && d.off+int64(n) > max {
+		return d.wrapError(d.off, fmt.Errorf("%w: input exceeds MaxBytes %d", ErrLimitExceeded, max))
+	}
+
+	return nil
+}
+
+// checkDepth returns ErrLimitExceeded if the path of the value starting at
+// offset is deeper than DecoderOptions.MaxDepth.
+func (d *Decoder) checkDepth(offset int64) error {
+	if max := d.opts.MaxDepth; max > 0 && len(d.path) > max {
+		return d.wrapError(offset, fmt.Errorf("%w: nesting exceeds MaxDepth %d", ErrLimitExceeded, max))
+	}
+
+	return nil
+}
+
+// ensureEOF returns ErrTrailingBytes if the input has not been fully consumed.
+func (d *Decoder) ensureEOF() error {
+	offset := d.off
+	if n := d.Remaining(); n >= 0 {
+		if n > 0 {
+			return d.wrapError(offset, fmt.Errorf("%w: %d bytes left", ErrTrailingBytes, n))
+		}
+
+		return nil
+	}
+
+	var b [1]byte
+	if _, err := io.ReadFull(d, b[:]); err != nil {
+		if err == io.EOF {
+			return nil
+		}
+
+		return d.wrapError(offset, err)
+	}
+
+	return d.wrapError(offset, ErrTrailingBytes)
+}
+
+// wrapError wraps err in a DecodeError for the value starting at offset,
+// unless err is nil or already wraps a DecodeError.
+func (d *Decoder) wrapError(offset int64, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var de *DecodeError
+	if errors.As(err, &de) {
+		return err
+	}
+
+	return &DecodeError{Offset: offset, Path: formatPath(d.path), Err: err}
+}
+
+// pushPath appends an element to the path of the value being decoded, which
+// starts at the current offset.
+func (d *Decoder) pushPath(elem pathElem) {
+	elem.offset = d.off
+	d.path = append(d.path, elem)
+}
+
+// truncatePath removes the elements of the path after the first n.
+func (d *Decoder) truncatePath(n int) {
+	d.path = d.path[:n]
+}
+
+// EnterField records that the values read until the matching Exit belong to
+// the struct field name, in the paths of errors and in trace spans. DecodeMtg
+// methods call it around each field. Fields left entered by a DecodeMtg method
+// that returns an error are discarded by DecodeValue and Reset. Entered fields
+// count towards DecoderOptions.MaxDepth: past it, reads return ErrLimitExceeded.
+func (d *Decoder) EnterField(name string) {
+	d.pushPath(pathElem{field: name})
+}
+
+// EnterIndex records that the values read until the matching Exit belong to
+// the element i of a slice or array, like EnterField.
+func (d *Decoder) EnterIndex(i int) {
+	d.pushPath(pathElem{index: i})
+}
+
+// Exit ends the field or element entered last, recording its span if the
+// Decoder is traced.
+func (d *Decoder) Exit() {
+	if len(d.path) == 0 {
+		return
+	}
+
+	if d.trace != nil {
+		d.trace.add(d, d.path[len(d.path)-1].offset, "", nil)
+	}
+
+	d.popPath()
 }
 
-// ReadN reads n bytes from the underlying input.
+// popPath removes the last element from the path of the value being decoded.
+func (d *Decoder) popPath() {
+	d.path = d.path[:len(d.path)-1]
+}
+
+// ReadN reads n bytes from the underlying input. The returned slice is a copy,
+// unless the Decoder reads from a byte slice with the ZeroCopy option.
 func (d *Decoder) ReadN(n int) ([]byte, error) {
+	if n < 0 {
+		return nil, d.wrapError(d.off, fmt.Errorf("invalid byte count %d", n))
+	}
+
+	if d.Reader == nil {
+		b, err := d.next(n)
+		if err != nil || d.opts.ZeroCopy {
+			return b, err
+		}
+
+		return append(make([]byte, 0, n), b...), nil
+	}
+
+	if err := d.checkRead(n); err != nil {
+		return nil, err
+	}
+
 	b := make([]byte, n)
+	if err := d.read(b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// Peek returns the next n bytes of the input without consuming them. The
+// returned slice shares memory with the input and is only valid until the next
+// read. A Decoder reading from an io.Reader can only peek if the reader has a
+// Peek method, like *bufio.Reader.
+func (d *Decoder) Peek(n int) ([]byte, error) {
+	if n < 0 {
+		return nil, d.wrapError(d.off, fmt.Errorf("invalid byte count %d", n))
+	}
+
+	if err := d.checkMaxBytes(n); err != nil {
+		return nil, err
+	}
+
+	if d.Reader == nil {
+		if n > d.Remaining() {
+			return nil, d.wrapError(d.off, ErrUnexpectedEOF)
+		}
+
+		return d.buf[d.off : d.off+int64(n)], nil
+	}
+
+	r, ok := d.Reader.(interface{ Peek(int) ([]byte, error) })
+	if !ok {
+		return nil, fmt.Errorf("%w: cannot peek %T, wrap it in a bufio.Reader", ErrUnsupportedType, d.Reader)
+	}
+
+	b, err := r.Peek(n)
+	if len(b) < n {
+		if err == nil || err == io.EOF {
+			err = ErrUnexpectedEOF
+		}
+
+		return nil, d.wrapError(d.off, err)
+	}
+
+	return b, nil
+}
+
+// Skip discards the next n bytes of the input.
+func (d *Decoder) Skip(n int) error {
+	if n < 0 {
+		return d.wrapError(d.off, fmt.Errorf("invalid byte count %d", n))
+	}
+
+	if err := d.checkRead(n); err != nil {
+		return err
+	}
+
+	offset := d.off
+	if d.Reader == nil {
+		if n > d.Remaining() {
+			d.off = int64(len(d.buf))
+			return d.wrapError(offset, ErrUnexpectedEOF)
+		}
+
+		d.off += int64(n)
+	} else if _, err := io.CopyN(io.Discard, d, int64(n)); err != nil {
+		if err == io.EOF {
+			err = ErrUnexpectedEOF
+		}
+
+		return d.wrapError(offset, err)
+	}
+
+	if d.trace != nil {
+		d.trace.add(d, offset, "skipped", nil)
+	}
+
+	return nil
+}
+
+// SkipString discards a string or byte slice without allocating it.
+func (d *Decoder) SkipString() error {
+	return d.SkipStringLen(0)
+}
+
+// SkipStringLen discards a string or byte slice whose length is encoded as an
+// integer of the length prefix p.
+func (d *Decoder) SkipStringLen(p LenPrefix) error {
+	l, err := d.DecodeLen(p)
+	if err != nil {
+		return err
+	}
+
+	return d.Skip(l)
+}
+
+// ReadFull reads exactly len(b) bytes from the underlying input into b. It
+// returns ErrUnexpectedEOF if the input ends before b is filled.
+func (d *Decoder) ReadFull(b []byte) error {
+	offset := d.off
 	err := d.read(b)
-	return b, err
+	if d.trace != nil && err == nil {
+		d.trace.add(d, offset, "bytes", append([]byte(nil), b...))
+	}
+
+	return err
 }
 
 // uint8 reads a uint8 from the underlying input.
 func (d *Decoder) uint8() (uint8, error) {
-	b, err := d.ReadN(1)
-	return b[0], err
+	b, err := d.next(1)
+	if err != nil {
+		return 0, err
+	}
+
+	return b[0], nil
 }
 
 // uint16 reads a uint16 from the underlying input.
 func (d *Decoder) uint16() (uint16, error) {
-	b, err := d.ReadN(2)
-	return binary.BigEndian.Uint16(b), err
+	b, err := d.next(2)
+	if err != nil {
+		return 0, err
+	}
+
+	return binary.BigEndian.Uint16(b), nil
 }
 
 // uint32 reads a uint32 from the underlying input.
 func (d *Decoder) uint32() (uint32, error) {
-	b, err := d.ReadN(4)
-	return binary.BigEndian.Uint32(b), err
+	b, err := d.next(4)
+	if err != nil {
+		return 0, err
+	}
+
+	return binary.BigEndian.Uint32(b), nil
 }
 
 // uint64 reads a uint64 from the underlying input.
 func (d *Decoder) uint64() (uint64, error) {
-	b, err := d.ReadN(8)
-	return binary.BigEndian.Uint64(b), err
+	b, err := d.next(8)
+	if err != nil {
+		return 0, err
+	}
+
+	return binary.BigEndian.Uint64(b), nil
+}
+
+// DecodeLen decodes a length encoded as an integer of the length prefix p, or of
+// the default length prefix of the Decoder if p is zero.
+func (d *Decoder) DecodeLen(p LenPrefix) (int, error) {
+	offset := d.off
+	l, err := d.decodeLen(p)
+	if err != nil {
+		return 0, err
+	}
+
+	if max := d.opts.MaxCollectionLen; max > 0 && l > max {
+		return 0, d.wrapError(offset, fmt.Errorf("%w: length %d exceeds MaxCollectionLen %d", ErrLimitExceeded, l, max))
+	}
+
+	if d.trace != nil {
+		d.trace.add(d, offset, "len", l)
+	}
+
+	return l, nil
 }
 
-// readLen reads the length of a byte array from the underlying input.
-func (d *Decoder) readLen() (int, error) {
-	l, err := d.uint8()
-	return int(l), err
+// decodeLen decodes a length encoded as an integer of the length prefix p.
+func (d *Decoder) decodeLen(p LenPrefix) (int, error) {
+	if p == 0 {
+		p = d.opts.LenPrefix
+	}
+
+	switch p {
+	case LenUint16:
+		l, err := d.uint16()
+		return int(l), err
+	case LenUint32:
+		l, err := d.uint32()
+		return int(l), err
+	case LenUvarint:
+		offset := d.off
+		l, err := d.DecodeUvarint()
+		if err != nil {
+			return 0, err
+		}
+
+		if l > math.MaxInt32 {
+			return 0, d.wrapError(offset, fmt.Errorf("%w: length %d", ErrTooLong, l))
+		}
+
+		return int(l), nil
+	default:
+		l, err := d.uint8()
+		return int(l), err
+	}
 }
 
 // DecodeUint8 decodes a uint8 from the input.
 func (d *Decoder) DecodeUint8() (uint8, error) {
-	return d.uint8()
+	offset := d.off
+	x, err := d.uint8()
+	if d.trace != nil && err == nil {
+		d.trace.add(d, offset, "uint8", x)
+	}
+
+	return x, err
 }
 
 // DecodeUint16 decodes a uint16 from the input.
 func (d *Decoder) DecodeUint16() (uint16, error) {
-	return d.uint16()
+	offset := d.off
+	x, err := d.uint16()
+	if d.trace != nil && err == nil {
+		d.trace.add(d, offset, "uint16", x)
+	}
+
+	return x, err
 }
 
 // DecodeUint32 decodes a uint32 from the input.
 func (d *Decoder) DecodeUint32() (uint32, error) {
-	return d.uint32()
+	offset := d.off
+	x, err := d.uint32()
+	if d.trace != nil && err == nil {
+		d.trace.add(d, offset, "uint32", x)
+	}
+
+	return x, err
 }
 
 // DecodeUint64 decodes a uint64 from the input.
 func (d *Decoder) DecodeUint64() (uint64, error) {
-	return d.uint64()
+	offset := d.off
+	x, err := d.uint64()
+	if d.trace != nil && err == nil {
+		d.trace.add(d, offset, "uint64", x)
+	}
+
+	return x, err
 }
 
 // DecodeInt8 decodes an int8 from the input.
 func (d *Decoder) DecodeInt8() (int8, error) {
+	offset := d.off
 	u, err := d.uint8()
+	if d.trace != nil && err == nil {
+		d.trace.add(d, offset, "int8", int8(u))
+	}
+
 	return int8(u), err
 }
 
 // DecodeInt16 decodes an int16 from the input.
 func (d *Decoder) DecodeInt16() (int16, error) {
+	offset := d.off
 	u, err := d.uint16()
+	if d.trace != nil && err == nil {
+		d.trace.add(d, offset, "int16", int16(u))
+	}
+
 	return int16(u), err
 }
 
 // DecodeInt32 decodes an int32 from the input.
 func (d *Decoder) DecodeInt32() (int32, error) {
+	offset := d.off
 	u, err := d.uint32()
+	if d.trace != nil && err == nil {
+		d.trace.add(d, offset, "int32", int32(u))
+	}
+
 	return int32(u), err
 }
 
 // DecodeInt64 decodes an int64 from the input.
 func (d *Decoder) DecodeInt64() (int64, error) {
+	offset := d.off
 	u, err := d.uint64()
+	if d.trace != nil && err == nil {
+		d.trace.add(d, offset, "int64", int64(u))
+	}
+
 	return int64(u), err
 }
 
+// DecodeVarint decodes a zigzag encoded varint from the input.
+func (d *Decoder) DecodeVarint() (int64, error) {
+	offset := d.off
+	u, err := d.DecodeUvarint()
+	if err != nil {
+		return 0, err
+	}
+
+	x := int64(u >> 1)
+	if u&1 != 0 {
+		x = ^x
+	}
+
+	if d.trace != nil {
+		d.trace.add(d, offset, "varint", x)
+	}
+
+	return x, nil
+}
+
+// DecodeUvarint decodes a varint from the input.
+func (d *Decoder) DecodeUvarint() (uint64, error) {
+	var (
+		offset = d.off
+		x      uint64
+		s      uint
+	)
+
+	for i := 0; i < binary.MaxVarintLen64; i++ {
+		b, err := d.uint8()
+		if err != nil {
+			return 0, err
+		}
+
+		if b < 0x80 {
+			if i == binary.MaxVarintLen64-1 && b > 1 {
+				break
+			}
+
+			if d.opts.Strict && i > 0 && b == 0 {
+				return 0, d.wrapError(offset, fmt.Errorf("%w: varint is not minimal", ErrNonCanonical))
+			}
+
+			x |= uint64(b) << s
+			if d.trace != nil {
+				d.trace.add(d, offset, "uvarint", x)
+			}
+
+			return x, nil
+		}
+
+		x |= uint64(b&0x7f) << s
+		s += 7
+	}
+
+	return 0, d.wrapError(offset, fmt.Errorf("%w: varint exceeds 64 bits", ErrOverflow))
+}
+
+// DecodeFloat32 decodes a float32 in IEEE 754 binary format from the input.
+func (d *Decoder) DecodeFloat32() (float32, error) {
+	offset := d.off
+	u, err := d.uint32()
+	if err != nil {
+		return 0, err
+	}
+
+	x := math.Float32frombits(u)
+	if d.opts.Strict && !isFinite(float64(x)) {
+		return 0, d.wrapError(offset, fmt.Errorf("%w: %v", ErrNonFinite, x))
+	}
+
+	if d.trace != nil {
+		d.trace.add(d, offset, "float32", x)
+	}
+
+	return x, nil
+}
+
+// DecodeFloat64 decodes a float64 in IEEE 754 binary format from the input.
+func (d *Decoder) DecodeFloat64() (float64, error) {
+	offset := d.off
+	u, err := d.uint64()
+	if err != nil {
+		return 0, err
+	}
+
+	x := math.Float64frombits(u)
+	if d.opts.Strict && !isFinite(x) {
+		return 0, d.wrapError(offset, fmt.Errorf("%w: %v", ErrNonFinite, x))
+	}
+
+	if d.trace != nil {
+		d.trace.add(d, offset, "float64", x)
+	}
+
+	return x, nil
+}
+
 // DecodeBool decodes a bool from the input.
 func (d *Decoder) DecodeBool() (bool, error) {
+	offset := d.off
 	u, err := d.uint8()
-	return u > 0, err
+	if err != nil {
+		return false, err
+	}
+
+	if d.opts.Strict && u > 1 {
+		return false, d.wrapError(offset, fmt.Errorf("%w: bool %d", ErrNonCanonical, u))
+	}
+
+	if d.trace != nil {
+		d.trace.add(d, offset, "bool", u > 0)
+	}
+
+	return u > 0, nil
+}
+
+// CheckOptional returns ErrNonCanonical in strict mode if an optional value,
+// whose presence flag starts at offset, was decoded as present but is zero.
+// Such values are encoded as absent. It is used by the generated DecodeMtg
+// methods of fields tagged as optional.
+func (d *Decoder) CheckOptional(offset int64, nonZero bool) error {
+	if d.opts.Strict && !nonZero {
+		return d.wrapError(offset, fmt.Errorf("%w: optional value is present but zero", ErrNonCanonical))
+	}
+
+	return nil
 }
 
 // DecodeBytes decodes a byte array from the input.
 func (d *Decoder) DecodeBytes() ([]byte, error) {
-	l, err := d.readLen()
+	return d.DecodeBytesLen(0)
+}
+
+// DecodeBytesLen decodes a byte array whose length is encoded as an integer of the length prefix p.
+func (d *Decoder) DecodeBytesLen(p LenPrefix) ([]byte, error) {
+	offset := d.off
+	l, err := d.DecodeLen(p)
 	if err != nil {
 		return nil, err
 	}
 
-	return d.ReadN(l)
+	b, err := d.ReadN(l)
+	if d.trace != nil && err == nil {
+		d.trace.add(d, offset, "[]byte", b)
+	}
+
+	return b, err
 }
 
 // DecodeString decodes a string from the input.
 func (d *Decoder) DecodeString() (string, error) {
 	b, err := d.DecodeBytes()
-	return bytesToString(b), err
+	if err != nil {
+		return "", err
+	}
+
+	return bytesToString(b), nil
+}
+
+// DecodeStringLen decodes a string whose length is encoded as an integer of the length prefix p.
+func (d *Decoder) DecodeStringLen(p LenPrefix) (string, error) {
+	offset := d.off
+	b, err := d.DecodeBytesLen(p)
+	if err != nil {
+		return "", err
+	}
+
+	if d.trace != nil {
+		d.trace.add(d, offset, "string", bytesToString(b))
+	}
+
+	return bytesToString(b), nil
+}
+
+// DecodeBinary decodes a byte slice encoded by EncodeBinary into u, with its
+// UnmarshalBinary method.
+func (d *Decoder) DecodeBinary(u encoding.BinaryUnmarshaler) error {
+	return d.DecodeBinaryLen(u, 0)
+}
+
+// DecodeBinaryLen decodes a byte slice whose length is encoded as an integer of
+// the length prefix p into u, like DecodeBinary.
+func (d *Decoder) DecodeBinaryLen(u encoding.BinaryUnmarshaler, p LenPrefix) error {
+	b, err := d.DecodeBytesLen(p)
+	if err != nil {
+		return err
+	}
+
+	return u.UnmarshalBinary(b)
+}
+
+// DecodeText decodes a string encoded by EncodeText into u, with its
+// UnmarshalText method.
+func (d *Decoder) DecodeText(u encoding.TextUnmarshaler) error {
+	return d.DecodeTextLen(u, 0)
+}
+
+// DecodeTextLen decodes a string whose length is encoded as an integer of the
+// length prefix p into u, like DecodeText.
+func (d *Decoder) DecodeTextLen(u encoding.TextUnmarshaler, p LenPrefix) error {
+	b, err := d.DecodeBytesLen(p)
+	if err != nil {
+		return err
+	}
+
+	return u.UnmarshalText(b)
 }
 
 // DecodeUUID decodes a UUID from the input.
 func (d *Decoder) DecodeUUID() (uuid.UUID, error) {
 	var id uuid.UUID
 
-	b, err := d.ReadN(len(id))
+	offset := d.off
+	b, err := d.next(len(id))
 	if err != nil {
 		return uuid.Nil, err
 	}
 
 	copy(id[:], b)
+	if d.trace != nil {
+		d.trace.add(d, offset, "uuid.UUID", id)
+	}
+
 	return id, nil
 }
 
-// DecodeDecimal decodes a decimal.Decimal number from the input.
+// DecodeDecimal decodes a decimal.Decimal number from the input, shifted by
+// DecoderOptions.DecimalPrecision, 8 if not set. With DecoderOptions.BigDecimal,
+// it uses DecodeBigDecimal instead.
 func (d *Decoder) DecodeDecimal() (decimal.Decimal, error) {
+	if d.opts.BigDecimal {
+		return d.DecodeBigDecimal()
+	}
+
+	prec := d.opts.DecimalPrecision
+	if prec == 0 {
+		prec = fixedDecimalPrecision
+	}
+
+	return d.DecodeDecimalPrec(prec)
+}
+
+// DecodeDecimalPrec decodes a decimal.Decimal number encoded with the precision
+// prec, which must be between 0 and MaxDecimalPrecision.
+func (d *Decoder) DecodeDecimalPrec(prec int32) (decimal.Decimal, error) {
+	offset := d.off
+	if err := checkDecimalPrec(prec); err != nil {
+		return decimal.Zero, d.wrapError(offset, err)
+	}
+
 	x, err := d.DecodeInt64()
 	if err != nil {
 		return decimal.Zero, err
 	}
 
-	return decimal.NewFromInt(x).Shift(-fixedDecimalPrecision), nil
+	v := decimal.NewFromInt(x).Shift(-prec)
+	if d.trace != nil {
+		d.trace.add(d, offset, "decimal.Decimal", v)
+	}
+
+	return v, nil
 }
 
-// DecodeTime decodes a time.Time from the input.
+// DecodeBigDecimal decodes a decimal.Decimal number encoded with EncodeBigDecimal.
+// It returns ErrOverflow if the exponent does not fit in an int32, and
+// ErrLimitExceeded if it exceeds DecoderOptions.MaxDecimalExponent.
+func (d *Decoder) DecodeBigDecimal() (decimal.Decimal, error) {
+	offset := d.off
+	coefficient, err := d.DecodeBigInt()
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	expOffset := d.off
+	exp, err := d.DecodeVarint()
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	if exp < math.MinInt32 || exp > math.MaxInt32 {
+		return decimal.Zero, d.wrapError(expOffset, fmt.Errorf("%w: exponent %d overflows int32", ErrOverflow, exp))
+	}
+
+	if max := int64(d.opts.MaxDecimalExponent); max > 0 && (exp > max || exp < -max) {
+		return decimal.Zero, d.wrapError(expOffset, fmt.Errorf("%w: exponent %d exceeds MaxDecimalExponent %d", ErrLimitExceeded, exp, max))
+	}
+
+	v := decimal.NewFromBigInt(coefficient, int32(exp))
+	if d.trace != nil {
+		d.trace.add(d, offset, "decimal.Decimal", v)
+	}
+
+	return v, nil
+}
+
+// DecodeBigInt decodes a *big.Int from the input. In strict mode, it returns
+// ErrNonCanonical for absolute values with leading zeros and for negative zero.
+func (d *Decoder) DecodeBigInt() (*big.Int, error) {
+	offset := d.off
+	x := new(big.Int)
+	if err := d.decodeBigInt(x); err != nil {
+		return nil, err
+	}
+
+	if d.trace != nil {
+		d.trace.add(d, offset, "*big.Int", x)
+	}
+
+	return x, nil
+}
+
+// decodeBigInt decodes an integer encoded with EncodeBigInt into z.
+func (d *Decoder) decodeBigInt(z *big.Int) error {
+	offset := d.off
+	sign, err := d.DecodeUint8()
+	if err != nil {
+		return err
+	}
+
+	if sign > 1 {
+		return d.wrapError(offset, fmt.Errorf("%w: invalid big.Int sign %d", ErrNonCanonical, sign))
+	}
+
+	l, err := d.DecodeLen(0)
+	if err != nil {
+		return err
+	}
+
+	b, err := d.next(l)
+	if err != nil {
+		return err
+	}
+
+	if d.opts.Strict {
+		if len(b) > 0 && b[0] == 0 {
+			return d.wrapError(offset, fmt.Errorf("%w: big.Int with leading zeros", ErrNonCanonical))
+		}
+
+		if sign == 1 && len(b) == 0 {
+			return d.wrapError(offset, fmt.Errorf("%w: negative zero big.Int", ErrNonCanonical))
+		}
+	}
+
+	z.SetBytes(b)
+	if sign == 1 {
+		z.Neg(z)
+	}
+
+	return nil
+}
+
+// DecodeTime decodes a time.Time from the input, encoded as a Unix timestamp in
+// the DecoderOptions.TimeUnit, nanoseconds if not set.
 func (d *Decoder) DecodeTime() (time.Time, error) {
+	return d.DecodeTimeUnit(0)
+}
+
+// DecodeTimeUnit decodes a time.Time encoded as a Unix timestamp in the unit u,
+// or in the default unit of the Decoder if u is zero.
+func (d *Decoder) DecodeTimeUnit(u TimeUnit) (time.Time, error) {
+	offset := d.off
 	x, err := d.DecodeInt64()
 	if err != nil {
 		return time.Time{}, err
 	}
 
-	return time.Unix(0, x), nil
+	t := d.TimeFromUnix(x, u)
+	if d.trace != nil {
+		d.trace.add(d, offset, "time.Time", t)
+	}
+
+	return t, nil
+}
+
+// TimeFromUnix returns the time of the Unix timestamp x in the unit u, or in the
+// default unit of the Decoder if u is zero, as DecodeTimeUnit decodes it. The
+// time is in UTC if DecoderOptions.UTC is set, in the local time otherwise.
+func (d *Decoder) TimeFromUnix(x int64, u TimeUnit) time.Time {
+	if u == 0 {
+		u = d.opts.TimeUnit
+	}
+
+	var t time.Time
+	switch u {
+	case TimeUnixMilli:
+		t = time.UnixMilli(x)
+	case TimeUnix:
+		t = time.Unix(x, 0)
+	default:
+		t = time.Unix(0, x)
+	}
+
+	if d.opts.UTC {
+		t = t.UTC()
+	}
+
+	return t
 }
@@ -1,8 +1,17 @@
 package mtgpack
 
 import (
+	"bytes"
+	"errors"
+	"math"
 	"reflect"
+	"runtime"
 	"testing"
+	"testing/iotest"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestDecodeUUID(t *testing.T) {
@@ -23,3 +32,281 @@ func TestDecodeUUID(t *testing.T) {
 
 	t.Logf("len: %d", val.Len())
 }
+
+func TestDecodeShortRead(t *testing.T) {
+	enc := NewEncoder()
+	id := uuid.New()
+	require.NoError(t, enc.EncodeValues(uint64(1)<<40, id, "hello"))
+
+	t.Run("one byte reader", func(t *testing.T) {
+		dec := &Decoder{Reader: iotest.OneByteReader(bytes.NewReader(enc.Bytes()))}
+
+		var (
+			x uint64
+			y uuid.UUID
+			z string
+		)
+
+		require.NoError(t, dec.DecodeAll(&x, &y, &z))
+		assert.Equal(t, uint64(1)<<40, x)
+		assert.Equal(t, id, y)
+		assert.Equal(t, "hello", z)
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		for n := 0; n < enc.Len(); n++ {
+			dec := &Decoder{Reader: iotest.HalfReader(bytes.NewReader(enc.Bytes()[:n]))}
+
+			var (
+				x uint64
+				y uuid.UUID
+				z string
+			)
+
+			err := dec.DecodeValues(&x, &y, &z)
+			assert.ErrorIsf(t, err, ErrUnexpectedEOF, "truncated at %d", n)
+		}
+
+		x, err := NewDecoder([]byte{1, 2, 3}).DecodeUint32()
+		assert.ErrorIs(t, err, ErrUnexpectedEOF)
+		assert.Zero(t, x)
+
+		b, err := NewDecoder(nil).DecodeUint8()
+		assert.ErrorIs(t, err, ErrUnexpectedEOF)
+		assert.Zero(t, b)
+	})
+
+	t.Run("empty string at end", func(t *testing.T) {
+		s, err := NewDecoder([]byte{0}).DecodeString()
+		require.NoError(t, err)
+		assert.Empty(t, s)
+	})
+}
+
+func TestDecodeAll(t *testing.T) {
+	dec := NewDecoder([]byte{1, 0, 2, 3})
+	assert.Equal(t, 4, dec.Remaining())
+
+	var x, y uint16
+	require.NoError(t, dec.DecodeAll(&x, &y))
+	assert.Equal(t, 0, dec.Remaining())
+
+	dec = NewDecoder([]byte{1, 0, 2})
+	assert.ErrorIs(t, dec.DecodeAll(&x), ErrTrailingBytes)
+	assert.Equal(t, 1, dec.Remaining())
+
+	t.Run("reader", func(t *testing.T) {
+		dec := &Decoder{Reader: iotest.OneByteReader(bytes.NewReader([]byte{1, 0, 2}))}
+		assert.Equal(t, -1, dec.Remaining())
+		assert.ErrorIs(t, dec.DecodeAll(&x), ErrTrailingBytes)
+
+		dec = &Decoder{Reader: iotest.OneByteReader(bytes.NewReader([]byte{1, 0}))}
+		assert.NoError(t, dec.DecodeAll(&x))
+	})
+}
+
+func TestDecodeZeroCopy(t *testing.T) {
+	enc := NewEncoder()
+	require.NoError(t, enc.EncodeValues("hello", []byte("world"), uint32(7)))
+	b := enc.Bytes()
+
+	dec := NewDecoder(b)
+	dec.SetOptions(DecoderOptions{ZeroCopy: true})
+
+	var (
+		s string
+		p []byte
+		x uint32
+	)
+
+	allocs := testing.AllocsPerRun(10, func() {
+		dec.Reset(b)
+		if err := dec.DecodeAll(&s, &p, &x); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	assert.Zero(t, allocs)
+	assert.Equal(t, "hello", s)
+	assert.Equal(t, []byte("world"), p)
+	assert.EqualValues(t, 7, x)
+
+	// decoded values share memory with the input
+	b[7] = 'W'
+	assert.Equal(t, []byte("World"), p)
+
+	t.Run("copy", func(t *testing.T) {
+		dec := NewDecoder(b)
+		require.NoError(t, dec.DecodeAll(&s, &p, &x))
+		b[7] = 'w'
+		assert.Equal(t, []byte("World"), p)
+	})
+}
+
+func TestDecodeLimits(t *testing.T) {
+	type node struct {
+		Name  string
+		Nodes []node
+	}
+
+	x := node{Name: "a", Nodes: []node{{Name: "b", Nodes: []node{{Name: "c"}}}}}
+	b, err := Marshal(x)
+	require.NoError(t, err)
+
+	decode := func(opts DecoderOptions, b []byte) error {
+		dec := NewDecoder(b)
+		dec.SetOptions(opts)
+		var y node
+		return dec.DecodeAll(&y)
+	}
+
+	assert.NoError(t, decode(DecoderOptions{MaxBytes: int64(len(b)), MaxCollectionLen: 1, MaxDepth: 5}, b))
+
+	t.Run("max bytes", func(t *testing.T) {
+		err := decode(DecoderOptions{MaxBytes: int64(len(b) - 1)}, b)
+		assert.ErrorIs(t, err, ErrLimitExceeded)
+
+		// a length prefix cannot make the reader decoder allocate past the limit
+		dec := &Decoder{Reader: bytes.NewReader([]byte{0xff, 0xff, 0xff, 0xff})}
+		dec.SetOptions(DecoderOptions{LenPrefix: LenUint32, MaxBytes: 1 << 10})
+		var p []byte
+		err = dec.DecodeAll(&p)
+		assert.ErrorIs(t, err, ErrLimitExceeded)
+
+		var de *DecodeError
+		require.True(t, errors.As(err, &de))
+		assert.Equal(t, int64(4), de.Offset)
+
+		// nor can the length prefix of a slice or map
+		huge := AppendUvarint(nil, math.MaxInt32)
+		for _, v := range []interface{}{&[]uint64{}, &map[uint64]string{}, &[]node{}} {
+			dec := NewDecoder(huge)
+			dec.SetOptions(DecoderOptions{LenPrefix: LenUvarint, MaxBytes: 100})
+
+			var before, after runtime.MemStats
+			runtime.ReadMemStats(&before)
+			assert.ErrorIs(t, dec.DecodeValue(v), ErrUnexpectedEOF)
+			runtime.ReadMemStats(&after)
+			assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(1<<20), "decode %T", v)
+		}
+
+		// elements of size 0 take no input, but count against the limit
+		decodeWith := func(opts DecoderOptions, b []byte, v interface{}) error {
+			dec := NewDecoder(b)
+			dec.SetOptions(opts)
+			return dec.DecodeAll(v)
+		}
+
+		for _, b := range [][]byte{{0x10, 0, 0, 0}, {0x7f, 0xff, 0xff, 0xff}} {
+			for _, v := range []interface{}{&[]struct{}{}, &map[struct{}]struct{}{}} {
+				opts := DecoderOptions{Strict: true, LenPrefix: LenUint32, MaxBytes: 100}
+
+				var before, after runtime.MemStats
+				runtime.ReadMemStats(&before)
+				assert.ErrorIs(t, decodeWith(opts, b, v), ErrLimitExceeded, "decode %T", v)
+				runtime.ReadMemStats(&after)
+				assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(1<<20), "decode %T", v)
+
+				dec := NewDecoder(b)
+				dec.SetOptions(opts)
+				assert.ErrorIs(t, dec.SkipValue(reflect.TypeOf(v).Elem()), ErrLimitExceeded, "skip %T", v)
+			}
+		}
+
+		x := make([]struct{}, 100)
+		b, err := Marshal(x)
+		require.NoError(t, err)
+		assert.NoError(t, decodeWith(DecoderOptions{MaxBytes: 101}, b, &x))
+		assert.ErrorIs(t, decodeWith(DecoderOptions{MaxBytes: 100}, b, &x), ErrLimitExceeded)
+	})
+
+	t.Run("max collection len", func(t *testing.T) {
+		err := decode(DecoderOptions{MaxCollectionLen: 0}, b)
+		assert.NoError(t, err)
+
+		b, err := Marshal(node{Name: "ab"})
+		require.NoError(t, err)
+
+		err = decode(DecoderOptions{MaxCollectionLen: 1}, b)
+		assert.ErrorIs(t, err, ErrLimitExceeded)
+
+		var de *DecodeError
+		require.True(t, errors.As(err, &de))
+		assert.Equal(t, "Name", de.Path)
+		assert.Equal(t, int64(0), de.Offset)
+	})
+
+	t.Run("max depth", func(t *testing.T) {
+		err := decode(DecoderOptions{MaxDepth: 4}, b)
+		assert.ErrorIs(t, err, ErrLimitExceeded)
+
+		var de *DecodeError
+		require.True(t, errors.As(err, &de))
+		assert.Equal(t, "Nodes[0].Nodes[0].Name", de.Path)
+	})
+}
+
+func TestDecodeStrict(t *testing.T) {
+	decode := func(b []byte, v interface{}) error {
+		dec := NewDecoder(b)
+		dec.SetOptions(DecoderOptions{Strict: true})
+		return dec.DecodeAll(v)
+	}
+
+	t.Run("bool", func(t *testing.T) {
+		var x bool
+		assert.NoError(t, decode([]byte{1}, &x))
+		assert.True(t, x)
+
+		assert.NoError(t, NewDecoder([]byte{2}).DecodeAll(&x))
+		assert.ErrorIs(t, decode([]byte{2}, &x), ErrNonCanonical)
+	})
+
+	t.Run("varint", func(t *testing.T) {
+		dec := NewDecoder([]byte{0x80, 0x01})
+		dec.SetOptions(DecoderOptions{Strict: true})
+		x, err := dec.DecodeUvarint()
+		require.NoError(t, err)
+		assert.EqualValues(t, 128, x)
+
+		dec = NewDecoder([]byte{0x81, 0x00})
+		x, err = dec.DecodeUvarint()
+		require.NoError(t, err)
+		assert.EqualValues(t, 1, x)
+
+		dec = NewDecoder([]byte{0x81, 0x00})
+		dec.SetOptions(DecoderOptions{Strict: true})
+		_, err = dec.DecodeUvarint()
+		assert.ErrorIs(t, err, ErrNonCanonical)
+
+		// the varint length prefix of a string
+		dec = NewDecoder([]byte{0x81, 0x00, 'a'})
+		dec.SetOptions(DecoderOptions{Strict: true})
+		_, err = dec.DecodeStringLen(LenUvarint)
+		assert.ErrorIs(t, err, ErrNonCanonical)
+	})
+
+	t.Run("optional", func(t *testing.T) {
+		type optional struct {
+			Version uint8
+			Name    string  `mtg:",optional"`
+			Amount  *uint16 // pointers to zero values are canonical
+		}
+
+		var x optional
+		assert.NoError(t, decode([]byte{1, 1, 1, 'a', 1, 0, 0}, &x))
+		assert.Equal(t, "a", x.Name)
+
+		b := []byte{1, 1, 0, 0}
+		assert.NoError(t, NewDecoder(b).DecodeAll(&x))
+		assert.Empty(t, x.Name)
+
+		err := decode(b, &x)
+		assert.ErrorIs(t, err, ErrNonCanonical)
+
+		var de *DecodeError
+		require.True(t, errors.As(err, &de))
+		assert.Equal(t, "Name", de.Path)
+		assert.Equal(t, int64(1), de.Offset)
+	})
+}
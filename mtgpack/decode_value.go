@@ -1,8 +1,15 @@
 package mtgpack
 
 import (
+	"bytes"
+	"encoding"
 	"fmt"
+	"math/big"
 	"reflect"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
 )
 
 func (d *Decoder) DecodeValue(v interface{}) error {
@@ -13,6 +20,10 @@ func (d *Decoder) DecodeValues(values ...interface{}) error {
 	return DecodeValues(d, values...)
 }
 
+func (d *Decoder) DecodeAll(values ...interface{}) error {
+	return DecodeAll(d, values...)
+}
+
 func DecodeValues(d *Decoder, values ...interface{}) error {
 	for _, v := range values {
 		if err := DecodeValue(d, v); err != nil {
@@ -23,61 +34,574 @@ func DecodeValues(d *Decoder, values ...interface{}) error {
 	return nil
 }
 
+// DecodeAll decodes the values like DecodeValues, then returns ErrTrailingBytes
+// if any input is left after the last value.
+func DecodeAll(d *Decoder, values ...interface{}) error {
+	if err := DecodeValues(d, values...); err != nil {
+		return err
+	}
+
+	return d.ensureEOF()
+}
+
 // DecodeValue decode a value from the decoder.
+//
+// Errors are returned as a *DecodeError, which records the offset and the
+// path of the value that failed. Like EncodeValue, the decoder of each type
+// is compiled on first use and cached.
 func DecodeValue(d *Decoder, v interface{}) error {
-	val := reflect.ValueOf(v)
-	typ := val.Type()
+	offset := d.off
+	defer d.truncatePath(len(d.path))
+
+	if decoder, ok := v.(CustomDecoder); ok {
+		if err := decoder.DecodeMtg(d); err != nil {
+			return d.wrapError(offset, err)
+		}
+
+		if d.trace != nil {
+			t := reflect.TypeOf(v)
+			if t.Kind() == reflect.Pointer {
+				t = t.Elem()
+			}
+
+			d.trace.add(d, offset, t.String(), nil)
+		}
+
+		return nil
+	}
 
-	if typ.Implements(customDecoderType) {
-		decoder := val.Interface().(CustomDecoder)
-		return decoder.DecodeMtg(d)
+	val := reflect.ValueOf(v)
+	if !val.IsValid() {
+		return d.wrapError(offset, fmt.Errorf("%w: %T", ErrUnsupportedType, v))
 	}
 
-	if typ.Kind() == reflect.Pointer {
-		typ = typ.Elem()
+	if val.Kind() == reflect.Pointer {
 		val = val.Elem()
 	}
 
 	if !val.CanSet() {
-		return fmt.Errorf("cannot set value: %s", typ)
+		return d.wrapError(offset, fmt.Errorf("cannot set value: %T", v))
+	}
+
+	if err := d.registry().typeDecoder(val.Type())(d, val); err != nil {
+		return d.wrapError(offset, err)
+	}
+
+	if d.trace != nil {
+		d.trace.addValue(d, offset, val)
+	}
+
+	return nil
+}
+
+// decoderFunc decodes into val, which is settable and has the type the function
+// was compiled for.
+type decoderFunc func(d *Decoder, val reflect.Value) error
+
+// typeDecoder returns the cached decoder of values of type t, compiling it on
+// first use. Nil pointers are allocated before the value is decoded into them.
+func (r *Registry) typeDecoder(t reflect.Type) decoderFunc {
+	if f, ok := r.decoders.Load(t); ok {
+		return f.(decoderFunc)
+	}
+
+	// see typeEncoder for recursive types
+	var (
+		wg sync.WaitGroup
+		f  decoderFunc
+	)
+
+	wg.Add(1)
+	fi, loaded := r.decoders.LoadOrStore(t, decoderFunc(func(d *Decoder, val reflect.Value) error {
+		wg.Wait()
+		return f(d, val)
+	}))
+	if loaded {
+		return fi.(decoderFunc)
+	}
+
+	f = r.newTypeDecoder(t)
+	wg.Done()
+	r.decoders.Store(t, f)
+	return f
+}
+
+func (r *Registry) newTypeDecoder(t reflect.Type) decoderFunc {
+	if t.Kind() != reflect.Pointer || reflect.PointerTo(t).Implements(customDecoderType) {
+		return r.newElemDecoder(t, fieldTag{})
+	}
+
+	elem := r.typeDecoder(t.Elem())
+	return func(d *Decoder, val reflect.Value) error {
+		if val.IsNil() {
+			val.Set(reflect.New(t.Elem()))
+		}
+
+		return elem(d, val.Elem())
+	}
+}
+
+// decodeChild decodes a value nested in a struct, slice or map with dec,
+// recording the given path element for errors.
+func decodeChild(d *Decoder, val reflect.Value, dec decoderFunc, elem pathElem) error {
+	offset := d.off
+	defer d.truncatePath(len(d.path))
+	d.pushPath(elem)
+
+	if err := d.checkDepth(offset); err != nil {
+		return err
 	}
 
-	switch typ {
-	case decimalType:
-		return decodeDecimalValue(d, val)
-	case timeType:
-		return decodeTimeValue(d, val)
+	if err := dec(d, val); err != nil {
+		return d.wrapError(offset, err)
+	}
+
+	if d.trace != nil {
+		d.trace.addValue(d, offset, val)
+	}
+
+	return nil
+}
+
+// newValueDecoder returns the decoder of values of type t nested in a struct,
+// slice or map. Pointers and fields tagged as optional are prefixed by a bool
+// that reports whether the value is present, absent values are decoded as nil or zero.
+func (r *Registry) newValueDecoder(t reflect.Type, tag fieldTag) decoderFunc {
+	zero := reflect.Zero(t)
+
+	if t.Kind() == reflect.Pointer {
+		var elem decoderFunc
+		if t.Implements(customDecoderType) {
+			elem = decodeCustom
+		} else {
+			dec := r.elemDecoder(t.Elem(), tag)
+			elem = func(d *Decoder, val reflect.Value) error {
+				return dec(d, val.Elem())
+			}
+		}
+
+		return func(d *Decoder, val reflect.Value) error {
+			present, err := d.DecodeBool()
+			if err != nil {
+				return err
+			}
+
+			if !present {
+				val.Set(zero)
+				return nil
+			}
+
+			if val.IsNil() {
+				val.Set(reflect.New(t.Elem()))
+			}
+
+			return elem(d, val)
+		}
+	}
+
+	dec := r.elemDecoder(t, tag)
+	if !tag.optional {
+		return dec
+	}
+
+	isZero := zeroChecker(t)
+	return func(d *Decoder, val reflect.Value) error {
+		offset := d.off
+		present, err := d.DecodeBool()
+		if err != nil {
+			return err
+		}
+
+		if !present {
+			val.Set(zero)
+			return nil
+		}
+
+		if err := dec(d, val); err != nil || !d.opts.Strict {
+			return err
+		}
+
+		return d.CheckOptional(offset, !isZero(val))
+	}
+}
+
+// elemDecoder returns the decoder of values of type t with the given tag, the
+// cached one if the tag does not change how the value itself is decoded.
+func (r *Registry) elemDecoder(t reflect.Type, tag fieldTag) decoderFunc {
+	if !tag.changesElem() {
+		return r.typeDecoder(t)
+	}
+
+	return r.newElemDecoder(t, tag)
+}
+
+func (r *Registry) newElemDecoder(t reflect.Type, tag fieldTag) decoderFunc {
+	if reflect.PointerTo(t).Implements(customDecoderType) {
+		return func(d *Decoder, val reflect.Value) error {
+			return decodeCustom(d, val.Addr())
+		}
+	}
+
+	if tag.text {
+		return newTextDecoder(t, tag.len)
+	}
+
+	if t == timeType && tag.changesElem() {
+		return r.newTimeDecoder(tag)
+	}
+
+	if tag.typ != nil {
+		return r.newOverrideDecoder(tag.typ, tag.varint)
+	}
+
+	if tag.varint {
+		return newVarintDecoder(t)
+	}
+
+	if t == decimalType && tag.hasPrec {
+		return newDecimalPrecDecoder(tag.prec)
+	}
+
+	if t == decimalType && tag.bigDecimal {
+		return decodeBigDecimalValue
+	}
+
+	// decimals, times, big integers and the types of RegisterType
+	if f, ok := r.lookup(t); ok {
+		return f.decode
 	}
 
 	// decode uuid.UUID
-	if size, ok := isByteArray(val); ok {
-		return decodeByteArrayValue(d, val, size)
+	if t.Kind() == reflect.Array && r.isBytes(t) {
+		return newByteArrayDecoder(t.Len())
+	}
+
+	if isBinaryType(t) {
+		return newBinaryDecoder(tag.len)
 	}
 
-	switch val.Kind() {
+	switch t.Kind() {
 	case reflect.Int, reflect.Int64:
-		return decodeInt64Value(d, val)
+		return decodeInt64Value
 	case reflect.Int8:
-		return decodeInt8Value(d, val)
+		return decodeInt8Value
 	case reflect.Int16:
-		return decodeInt16Value(d, val)
+		return decodeInt16Value
 	case reflect.Int32:
-		return decodeInt32Value(d, val)
+		return decodeInt32Value
 	case reflect.Uint, reflect.Uint64:
-		return decodeUint64Value(d, val)
+		return decodeUint64Value
 	case reflect.Uint8:
-		return decodeUint8Value(d, val)
+		return decodeUint8Value
 	case reflect.Uint16:
-		return decodeUint16Value(d, val)
+		return decodeUint16Value
 	case reflect.Uint32:
-		return decodeUint32Value(d, val)
+		return decodeUint32Value
+	case reflect.Float32:
+		return decodeFloat32Value
+	case reflect.Float64:
+		return decodeFloat64Value
 	case reflect.Bool:
-		return decodeBoolValue(d, val)
+		return decodeBoolValue
 	case reflect.String:
-		return decodeStringValue(d, val)
+		p := tag.len
+		return func(d *Decoder, val reflect.Value) error {
+			s, err := d.DecodeStringLen(p)
+			if err != nil {
+				return err
+			}
+
+			val.SetString(s)
+			return nil
+		}
+	case reflect.Struct:
+		return r.newStructDecoder(t)
+	case reflect.Slice:
+		return r.newSliceDecoder(t, tag.len)
+	case reflect.Array:
+		return r.newArrayDecoder(t)
+	case reflect.Map:
+		return r.newMapDecoder(t, tag.len)
+	case reflect.Interface:
+		return newUnionDecoder(t)
+	}
+
+	return newErrorDecoder(fmt.Errorf("%w: %s", ErrUnsupportedType, t))
+}
+
+// newErrorDecoder returns a decoder that fails with err, for types that cannot be decoded.
+func newErrorDecoder(err error) decoderFunc {
+	return func(d *Decoder, val reflect.Value) error {
+		return err
+	}
+}
+
+// decodeCustom decodes into the value pointed to by ptr, which implements CustomDecoder.
+func decodeCustom(d *Decoder, ptr reflect.Value) error {
+	return ptr.Interface().(CustomDecoder).DecodeMtg(d)
+}
+
+// newBinaryDecoder returns the decoder of values whose pointer implements
+// encoding.BinaryUnmarshaler, with the length prefix p.
+func newBinaryDecoder(p LenPrefix) decoderFunc {
+	return func(d *Decoder, val reflect.Value) error {
+		return d.DecodeBinaryLen(val.Addr().Interface().(encoding.BinaryUnmarshaler), p)
+	}
+}
+
+// newTextDecoder returns the decoder of values of type t, whose pointer must
+// implement encoding.TextUnmarshaler, with the length prefix p.
+func newTextDecoder(t reflect.Type, p LenPrefix) decoderFunc {
+	if !reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		err := fmt.Errorf("%w: %s does not implement encoding.TextUnmarshaler", ErrUnsupportedType, t)
+		return func(d *Decoder, val reflect.Value) error {
+			return err
+		}
+	}
+
+	return func(d *Decoder, val reflect.Value) error {
+		return d.DecodeTextLen(val.Addr().Interface().(encoding.TextUnmarshaler), p)
+	}
+}
+
+// newOverrideDecoder returns the decoder of integers encoded as the integer type typ.
+func (r *Registry) newOverrideDecoder(typ reflect.Type, varint bool) decoderFunc {
+	dec := r.newElemDecoder(typ, fieldTag{varint: varint})
+	return func(d *Decoder, val reflect.Value) error {
+		x := reflect.New(typ).Elem()
+		if err := dec(d, x); err != nil {
+			return err
+		}
+
+		return setInt(val, x)
+	}
+}
+
+// newVarintDecoder returns the decoder of a zigzag varint into a signed integer
+// and of a varint into an unsigned integer, which fails if the decoded value
+// does not fit.
+func newVarintDecoder(t reflect.Type) decoderFunc {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return func(d *Decoder, val reflect.Value) error {
+			i, err := d.DecodeVarint()
+			if err != nil {
+				return err
+			}
+
+			if val.OverflowInt(i) {
+				return fmt.Errorf("%w: value %d overflows %s", ErrOverflow, i, val.Type())
+			}
+
+			val.SetInt(i)
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return func(d *Decoder, val reflect.Value) error {
+			u, err := d.DecodeUvarint()
+			if err != nil {
+				return err
+			}
+
+			if val.OverflowUint(u) {
+				return fmt.Errorf("%w: value %d overflows %s", ErrOverflow, u, val.Type())
+			}
+
+			val.SetUint(u)
+			return nil
+		}
+	}
+
+	return newErrorDecoder(fmt.Errorf("%w: varint %s", ErrUnsupportedType, t))
+}
+
+// newByteArrayDecoder returns the decoder of byte arrays of the given size.
+func newByteArrayDecoder(size int) decoderFunc {
+	return func(d *Decoder, val reflect.Value) error {
+		b, err := d.next(size)
+		if err != nil {
+			return err
+		}
+
+		copy(val.Slice(0, size).Bytes(), b)
+		return nil
+	}
+}
+
+// newSliceDecoder returns the decoder of a length prefixed slice into a freshly allocated slice.
+func (r *Registry) newSliceDecoder(t reflect.Type, p LenPrefix) decoderFunc {
+	if r.isBytes(t) {
+		return func(d *Decoder, val reflect.Value) error {
+			b, err := d.DecodeBytesLen(p)
+			if err != nil {
+				return err
+			}
+
+			val.SetBytes(b)
+			return nil
+		}
+	}
+
+	elem := r.newValueDecoder(t.Elem(), fieldTag{})
+	zero := reflect.Zero(t.Elem())
+	return func(d *Decoder, val reflect.Value) error {
+		n, err := d.DecodeLen(p)
+		if err != nil {
+			return err
+		}
+
+		if err := d.checkZeroSize(n, t.Elem().Size()); err != nil {
+			return err
+		}
+
+		s := val.Slice(0, 0)
+		if !d.opts.ReuseSlices || val.Cap() < n {
+			s = reflect.MakeSlice(t, 0, preallocLen(n, t.Elem().Size()))
+		}
+
+		for i := 0; i < n; i++ {
+			s = reflect.Append(s, zero)
+			if err := decodeChild(d, s.Index(i), elem, pathElem{index: i}); err != nil {
+				return err
+			}
+		}
+
+		val.Set(s)
+		return nil
 	}
+}
+
+func (r *Registry) newArrayDecoder(t reflect.Type) decoderFunc {
+	elem := r.newValueDecoder(t.Elem(), fieldTag{})
+	return func(d *Decoder, val reflect.Value) error {
+		for i := 0; i < val.Len(); i++ {
+			if err := decodeChild(d, val.Index(i), elem, pathElem{index: i}); err != nil {
+				return err
+			}
+		}
 
-	return fmt.Errorf("unsupported type: %s", typ)
+		return nil
+	}
+}
+
+// newMapDecoder returns the decoder of a length prefixed map into a freshly
+// allocated map. In strict mode, keys must be unique and sorted by their encoded bytes.
+func (r *Registry) newMapDecoder(t reflect.Type, p LenPrefix) decoderFunc {
+	key := r.newValueDecoder(t.Key(), fieldTag{})
+	value := r.newValueDecoder(t.Elem(), fieldTag{})
+	return func(d *Decoder, val reflect.Value) error {
+		n, err := d.DecodeLen(p)
+		if err != nil {
+			return err
+		}
+
+		size := t.Key().Size() + t.Elem().Size()
+		if err := d.checkZeroSize(n, size); err != nil {
+			return err
+		}
+
+		m := reflect.MakeMapWithSize(t, preallocLen(n, size))
+
+		var prev []byte
+		for i := 0; i < n; i++ {
+			offset := d.off
+			k := reflect.New(t.Key()).Elem()
+			b, err := d.captureRead(func() error {
+				return decodeChild(d, k, key, pathElem{index: i})
+			})
+			if err != nil {
+				return err
+			}
+
+			// canonical keys are sorted by their encoded bytes
+			if d.opts.Strict {
+				if i > 0 && bytes.Compare(prev, b) >= 0 {
+					d.pushPath(pathElem{key: k})
+					err := d.wrapError(offset, fmt.Errorf("%w: map key is duplicated or out of order", ErrNonCanonical))
+					d.popPath()
+					return err
+				}
+
+				prev = b
+			}
+
+			v := reflect.New(t.Elem()).Elem()
+			if err := decodeChild(d, v, value, pathElem{key: k}); err != nil {
+				return err
+			}
+
+			m.SetMapIndex(k, v)
+		}
+
+		val.Set(m)
+		return nil
+	}
+}
+
+// maxPreallocBytes is the maximum size of the elements allocated for a slice or
+// map before they are decoded, beyond which it grows as they are decoded.
+const maxPreallocBytes = 64 << 10
+
+// preallocLen returns the number of elements of the given size to allocate for
+// a slice or map of length n, read from a length prefix that may not be backed
+// by as many elements in the input. Elements of size 0 count as one byte, as a
+// map allocates room for each entry anyway.
+func preallocLen(n int, size uintptr) int {
+	if size == 0 {
+		size = 1
+	}
+
+	if uintptr(n) > maxPreallocBytes/size {
+		return int(maxPreallocBytes / size)
+	}
+
+	return n
+}
+
+// checkZeroSize returns ErrLimitExceeded if a slice or map of n elements of the
+// given size exceeds DecoderOptions.MaxBytes. Elements of size 0 take no input,
+// so each of them counts as one byte, or the length prefix alone would make the
+// Decoder loop over as many elements as it claims.
+func (d *Decoder) checkZeroSize(n int, size uintptr) error {
+	if size > 0 {
+		return nil
+	}
+
+	return d.checkMaxBytes(n)
+}
+
+// fieldDecoder decodes a field of a struct.
+type fieldDecoder struct {
+	name  string
+	index int
+	dec   decoderFunc
+}
+
+// newStructDecoder returns the decoder of the fields of a struct in declaration order.
+func (r *Registry) newStructDecoder(t reflect.Type) decoderFunc {
+	fields, err := typeFields(t)
+	if err != nil {
+		return newErrorDecoder(err)
+	}
+
+	decoders := make([]fieldDecoder, 0, len(fields))
+	for _, f := range fields {
+		decoders = append(decoders, fieldDecoder{
+			name:  f.name,
+			index: f.index,
+			dec:   r.newValueDecoder(t.Field(f.index).Type, f.tag),
+		})
+	}
+
+	return func(d *Decoder, val reflect.Value) error {
+		for _, f := range decoders {
+			if err := decodeChild(d, val.Field(f.index), f.dec, pathElem{field: f.name}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
 }
 
 func decodeInt8Value(d *Decoder, val reflect.Value) error {
@@ -160,13 +684,23 @@ func decodeUint64Value(d *Decoder, val reflect.Value) error {
 	return nil
 }
 
-func decodeStringValue(d *Decoder, val reflect.Value) error {
-	s, err := d.DecodeString()
+func decodeFloat32Value(d *Decoder, val reflect.Value) error {
+	x, err := d.DecodeFloat32()
 	if err != nil {
 		return err
 	}
 
-	val.SetString(s)
+	val.SetFloat(float64(x))
+	return nil
+}
+
+func decodeFloat64Value(d *Decoder, val reflect.Value) error {
+	x, err := d.DecodeFloat64()
+	if err != nil {
+		return err
+	}
+
+	val.SetFloat(x)
 	return nil
 }
 
@@ -186,26 +720,70 @@ func decodeDecimalValue(d *Decoder, val reflect.Value) error {
 		return err
 	}
 
-	val.Set(reflect.ValueOf(n))
+	*val.Addr().Interface().(*decimal.Decimal) = n
 	return nil
 }
 
-func decodeByteArrayValue(d *Decoder, val reflect.Value, size int) error {
-	b, err := d.ReadN(size)
+// newDecimalPrecDecoder returns the decoder of decimals with the precision prec.
+func newDecimalPrecDecoder(prec int32) decoderFunc {
+	return func(d *Decoder, val reflect.Value) error {
+		n, err := d.DecodeDecimalPrec(prec)
+		if err != nil {
+			return err
+		}
+
+		*val.Addr().Interface().(*decimal.Decimal) = n
+		return nil
+	}
+}
+
+func decodeBigDecimalValue(d *Decoder, val reflect.Value) error {
+	n, err := d.DecodeBigDecimal()
 	if err != nil {
 		return err
 	}
 
-	reflect.Copy(val, reflect.ValueOf(b))
+	*val.Addr().Interface().(*decimal.Decimal) = n
 	return nil
 }
 
+func decodeBigIntValue(d *Decoder, val reflect.Value) error {
+	return d.decodeBigInt(val.Addr().Interface().(*big.Int))
+}
+
 func decodeTimeValue(d *Decoder, val reflect.Value) error {
 	t, err := d.DecodeTime()
 	if err != nil {
 		return err
 	}
 
-	val.Set(reflect.ValueOf(t))
+	*val.Addr().Interface().(*time.Time) = t
 	return nil
 }
+
+// newTimeDecoder returns the decoder of times with the unit and the integer
+// encoding selected by the tag.
+func (r *Registry) newTimeDecoder(tag fieldTag) decoderFunc {
+	unit, utc := tag.timeUnit, tag.utc
+
+	typ := tag.typ
+	if typ == nil {
+		typ = overrideTypes["int64"]
+	}
+
+	dec := r.newOverrideDecoder(typ, tag.varint)
+	return func(d *Decoder, val reflect.Value) error {
+		var x int64
+		if err := dec(d, reflect.ValueOf(&x).Elem()); err != nil {
+			return err
+		}
+
+		t := d.TimeFromUnix(x, unit)
+		if utc {
+			t = t.UTC()
+		}
+
+		*val.Addr().Interface().(*time.Time) = t
+		return nil
+	}
+}
@@ -147,3 +147,108 @@ func TestDecodeValue(t *testing.T) {
 
 	assert.Emptyf(t, buf.Len(), "decoder has not remaining bytes")
 }
+
+func TestDecodeVarint(t *testing.T) {
+	enc := NewEncoder()
+
+	for _, x := range []int64{0, 1, -1, 63, -64, 64, math.MaxInt64, math.MinInt64} {
+		enc.Reset()
+		require.NoError(t, enc.EncodeVarint(x))
+		y, err := NewDecoder(enc.Bytes()).DecodeVarint()
+		require.NoError(t, err)
+		assert.Equal(t, x, y)
+	}
+
+	for _, x := range []uint64{0, 1, 127, 128, 300, math.MaxUint32, math.MaxUint64} {
+		enc.Reset()
+		require.NoError(t, enc.EncodeUvarint(x))
+		y, err := NewDecoder(enc.Bytes()).DecodeUvarint()
+		require.NoError(t, err)
+		assert.Equal(t, x, y)
+	}
+
+	t.Run("overflow", func(t *testing.T) {
+		b := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x02}
+		_, err := NewDecoder(b).DecodeUvarint()
+		assert.Error(t, err)
+	})
+
+	t.Run("struct", func(t *testing.T) {
+		type swap struct {
+			Action uint16 `mtg:",varint"`
+			Amount int64  `mtg:",varint"`
+			Hops   int    `mtg:"uint8,varint"`
+		}
+
+		x := swap{Action: 3, Amount: -200, Hops: 2}
+		enc.Reset()
+		require.NoError(t, EncodeValue(enc, x))
+		assert.Equal(t, []byte{0x03, 0x8f, 0x03, 0x02}, enc.Bytes())
+
+		var y swap
+		require.NoError(t, DecodeValue(NewDecoder(enc.Bytes()), &y))
+		assert.Equal(t, x, y)
+
+		enc.Reset()
+		require.NoError(t, enc.EncodeUvarint(math.MaxUint16+1))
+		require.NoError(t, enc.EncodeVarint(0))
+		require.NoError(t, enc.EncodeVarint(0))
+		assert.Error(t, DecodeValue(NewDecoder(enc.Bytes()), &y), "overflows uint16")
+	})
+}
+
+func BenchmarkDecodeStruct(b *testing.B) {
+	enc := NewEncoder()
+	require.NoError(b, enc.EncodeValue(testOrder{
+		Header: testHeader{Version: 1, Action: 3},
+		Asset:  uuid.New(),
+		Amount: decimal.NewFromFloat(1.5),
+		Route:  "xvgf",
+		Count:  2,
+	}))
+
+	data := enc.Bytes()
+	dec := NewDecoder(nil)
+
+	var x testOrder
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		dec.Reset(data)
+		if err := dec.DecodeValue(&x); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestDecodeReuseSlices(t *testing.T) {
+	b, err := Marshal([]uint16{1, 2})
+	require.NoError(t, err)
+
+	// slices are decoded into a new array unless ReuseSlices is set
+	array := make([]uint16, 4)
+	x := array[:1]
+	require.NoError(t, NewDecoder(b).DecodeValue(&x))
+	assert.Equal(t, []uint16{1, 2}, x)
+	assert.Equal(t, []uint16{0, 0, 0, 0}, array)
+
+	x = array[:1]
+	dec := NewDecoder(b)
+	dec.SetOptions(DecoderOptions{ReuseSlices: true})
+	require.NoError(t, dec.DecodeValue(&x))
+	assert.Equal(t, []uint16{1, 2}, x)
+	assert.Equal(t, []uint16{1, 2, 0, 0}, array)
+
+	// or the array is too small
+	x = array[:0:1]
+	dec = NewDecoder(b)
+	dec.SetOptions(DecoderOptions{ReuseSlices: true})
+	require.NoError(t, dec.DecodeValue(&x))
+	assert.Equal(t, 2, cap(x))
+
+	s, err := MakeSlice[[]uint16](dec, array, 4)
+	require.NoError(t, err)
+	assert.Same(t, &array[0], &s[:1][0])
+}
@@ -2,22 +2,130 @@ package mtgpack
 
 import (
 	"bytes"
+	"encoding"
 	"encoding/binary"
+	"fmt"
+	"io"
 	"math"
+	"math/big"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/shopspring/decimal"
 )
 
-// fixedDecimalPrecision defines the fixed decimal precision to 8.
+// fixedDecimalPrecision defines the default decimal precision to 8.
 const (
 	fixedDecimalPrecision int32 = 8
 )
 
+// MaxDecimalPrecision is the largest precision of decimals, the number of
+// digits of an int64 minus one.
+const MaxDecimalPrecision int32 = 18
+
+// streamBufferSize is the number of buffered bytes at which a streaming Encoder
+// flushes to its writer.
+const streamBufferSize = 4096
+
+// LenPrefix selects the integer type used to encode the length of strings,
+// byte slices, slices and maps. The zero value selects the default length
+// prefix, which is LenUint8 unless configured otherwise in the options of the
+// Encoder or Decoder.
+type LenPrefix uint8
+
+const (
+	LenUint8 LenPrefix = iota + 1
+	LenUint16
+	LenUint32
+	LenUvarint
+)
+
+// String returns the name of the length prefix as used in `mtg` tags.
+func (p LenPrefix) String() string {
+	switch p {
+	case LenUint8:
+		return "uint8"
+	case LenUint16:
+		return "uint16"
+	case LenUint32:
+		return "uint32"
+	case LenUvarint:
+		return "uvarint"
+	}
+
+	return "default"
+}
+
+// TimeUnit selects the unit of the Unix timestamp a time is encoded as. The zero
+// value selects the default unit, which is TimeUnixNano unless configured
+// otherwise in the options of the Encoder or Decoder.
+type TimeUnit uint8
+
+const (
+	TimeUnixNano TimeUnit = iota + 1
+	TimeUnixMilli
+	TimeUnix
+)
+
+// String returns the name of the time unit as used in `mtg` tags.
+func (u TimeUnit) String() string {
+	switch u {
+	case TimeUnixNano:
+		return "unixnano"
+	case TimeUnixMilli:
+		return "unixmilli"
+	case TimeUnix:
+		return "unix"
+	}
+
+	return "default"
+}
+
+// duration returns the duration of the time unit, nanoseconds if it is not set.
+func (u TimeUnit) duration() time.Duration {
+	switch u {
+	case TimeUnixMilli:
+		return time.Millisecond
+	case TimeUnix:
+		return time.Second
+	}
+
+	return time.Nanosecond
+}
+
+// EncoderOptions controls how an Encoder validates the values it encodes.
+type EncoderOptions struct {
+	// Strict rejects values that would not decode identically on every node,
+	// such as NaN and infinite floats, decimals that have more digits than
+	// their precision or do not fit in an int64 once shifted, and times that
+	// are more precise than their TimeUnit.
+	Strict bool
+
+	// LenPrefix is the default length prefix of strings, byte slices, slices
+	// and maps, LenUint8 if not set. The Decoder must use the same prefix.
+	LenPrefix LenPrefix
+
+	// DecimalPrecision is the default number of fractional digits of decimals,
+	// 8 if not set, at most MaxDecimalPrecision. The Decoder must use the same
+	// precision.
+	DecimalPrecision int32
+
+	// BigDecimal encodes decimals with EncodeBigDecimal instead of as a fixed
+	// precision int64. The Decoder must use the same mode.
+	BigDecimal bool
+
+	// TimeUnit is the default unit of times, TimeUnixNano if not set. The
+	// Decoder must use the same unit.
+	TimeUnit TimeUnit
+}
+
 // Encoder provides methods for encoding different data types into a byte buffer.
 type Encoder struct {
-	buf *bytes.Buffer // the byte buffer where encoded data is written
+	buf   *bytes.Buffer // the byte buffer where encoded data is written
+	opts  EncoderOptions
+	types *Registry // the registered types, nil for the default Registry
+	w     io.Writer // the writer a streaming Encoder flushes the buffer to
+	err   error     // the first error returned by w
 }
 
 // NewEncoder constructs and returns a new Encoder.
@@ -25,30 +133,95 @@ func NewEncoder() *Encoder {
 	return &Encoder{buf: &bytes.Buffer{}}
 }
 
+// NewStreamEncoder constructs and returns a new Encoder that writes encoded data
+// to w, such as a file, a socket or a hash. Data is buffered and written to w in
+// chunks, call Flush after the last value to write the rest. Once a write to w
+// fails, the Encoder returns the same error for every later write.
+func NewStreamEncoder(w io.Writer) *Encoder {
+	return &Encoder{buf: bytes.NewBuffer(make([]byte, 0, streamBufferSize)), w: w}
+}
+
+// SetOptions replaces the options of the Encoder. It returns an error, and
+// keeps the current options, if EncoderOptions.DecimalPrecision is out of range.
+func (e *Encoder) SetOptions(opts EncoderOptions) error {
+	if err := checkDecimalPrec(opts.DecimalPrecision); err != nil {
+		return err
+	}
+
+	e.opts = opts
+	return nil
+}
+
+// Options returns the options of the Encoder.
+func (e *Encoder) Options() EncoderOptions {
+	return e.opts
+}
+
 // Bytes returns the current contents of the Encoder's buffer as a byte slice.
+// For a streaming Encoder, it only contains the data not flushed yet.
 func (e *Encoder) Bytes() []byte {
 	return e.buf.Bytes()
 }
 
-// Reset resets the Encoder's buffer to an empty state.
+// Reset resets the Encoder's buffer to an empty state. For a streaming Encoder,
+// the data not flushed yet is discarded.
 func (e *Encoder) Reset() {
 	e.buf.Reset()
 }
 
 // Len returns the number of bytes currently written to the buffer.
+// For a streaming Encoder, it only counts the data not flushed yet.
 func (e *Encoder) Len() int {
 	return e.buf.Len()
 }
 
 // Write implements io.Writer interface and writes the given bytes to the buffer.
 func (e *Encoder) Write(b []byte) (int, error) {
-	return e.buf.Write(b)
+	if err := e.write(b); err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
 }
 
-// write writes the given bytes to the buffer.
+// Flush writes the buffered data of a streaming Encoder to its writer. It does
+// nothing for an Encoder constructed by NewEncoder.
+func (e *Encoder) Flush() error {
+	if e.err != nil {
+		return e.err
+	}
+
+	if e.w == nil || e.buf.Len() == 0 {
+		return nil
+	}
+
+	n, err := e.w.Write(e.buf.Bytes())
+	if err == nil && n < e.buf.Len() {
+		err = io.ErrShortWrite
+	}
+
+	if err != nil {
+		e.err = err
+		return err
+	}
+
+	e.buf.Reset()
+	return nil
+}
+
+// write writes the given bytes to the buffer, flushing it to the writer of a
+// streaming Encoder once it is full.
 func (e *Encoder) write(b []byte) error {
-	_, err := e.buf.Write(b)
-	return err
+	if e.err != nil {
+		return e.err
+	}
+
+	e.buf.Write(b)
+	if e.w != nil && e.buf.Len() >= streamBufferSize {
+		return e.Flush()
+	}
+
+	return nil
 }
 
 // write1 writes the given byte to the buffer.
@@ -59,31 +232,36 @@ func (e *Encoder) write1(x uint8) error {
 // write2 writes the given uint16 to the buffer in big-endian format.
 func (e *Encoder) write2(x uint16) error {
 	var b [2]byte
-	binary.BigEndian.PutUint16(b[:], x)
-	return e.write(b[:])
+	return e.write(AppendUint16(b[:0], x))
 }
 
 // write4 writes the given uint32 to the buffer in big-endian format.
 func (e *Encoder) write4(x uint32) error {
 	var b [4]byte
-	binary.BigEndian.PutUint32(b[:], x)
-	return e.write(b[:])
+	return e.write(AppendUint32(b[:0], x))
 }
 
 // write8 writes the given uint64 to the buffer in big-endian format.
 func (e *Encoder) write8(x uint64) error {
 	var b [8]byte
-	binary.BigEndian.PutUint64(b[:], x)
-	return e.write(b[:])
+	return e.write(AppendUint64(b[:0], x))
 }
 
-// writeLen writes the given length as an uint8 to the buffer.
-func (e *Encoder) writeLen(l int) error {
-	if l > math.MaxUint8 {
-		panic("too long")
+// EncodeLen encodes the given length as an integer of the length prefix p, or of
+// the default length prefix of the Encoder if p is zero. It returns ErrTooLong
+// if the length does not fit in the prefix.
+func (e *Encoder) EncodeLen(l int, p LenPrefix) error {
+	if p == 0 {
+		p = e.opts.LenPrefix
+	}
+
+	var b [binary.MaxVarintLen64]byte
+	buf, err := AppendLen(b[:0], l, p)
+	if err != nil {
+		return err
 	}
 
-	return e.write1(uint8(l))
+	return e.write(buf)
 }
 
 // EncodeInt encodes the given int into the buffer as a uint32.
@@ -111,6 +289,20 @@ func (e *Encoder) EncodeInt64(x int64) error {
 	return e.write8(uint64(x))
 }
 
+// EncodeVarint encodes the given int64 into the buffer as a zigzag encoded varint,
+// which takes between 1 and 10 bytes depending on the magnitude of x.
+func (e *Encoder) EncodeVarint(x int64) error {
+	var b [binary.MaxVarintLen64]byte
+	return e.write(AppendVarint(b[:0], x))
+}
+
+// EncodeUvarint encodes the given uint64 into the buffer as a varint, which
+// takes between 1 and 10 bytes depending on the magnitude of x.
+func (e *Encoder) EncodeUvarint(x uint64) error {
+	var b [binary.MaxVarintLen64]byte
+	return e.write(AppendUvarint(b[:0], x))
+}
+
 // EncodeUint8 encodes the given uint8 into the buffer.
 func (e *Encoder) EncodeUint8(x uint8) error {
 	return e.write1(x)
@@ -131,15 +323,46 @@ func (e *Encoder) EncodeUint64(x uint64) error {
 	return e.write8(x)
 }
 
+// EncodeFloat32 encodes the given float32 into the buffer in IEEE 754 binary format.
+// In strict mode, NaN and infinities are rejected.
+func (e *Encoder) EncodeFloat32(x float32) error {
+	if e.opts.Strict && !isFinite(float64(x)) {
+		return fmt.Errorf("%w: %v", ErrNonFinite, x)
+	}
+
+	return e.write4(math.Float32bits(x))
+}
+
+// EncodeFloat64 encodes the given float64 into the buffer in IEEE 754 binary format.
+// In strict mode, NaN and infinities are rejected.
+func (e *Encoder) EncodeFloat64(x float64) error {
+	if e.opts.Strict && !isFinite(x) {
+		return fmt.Errorf("%w: %v", ErrNonFinite, x)
+	}
+
+	return e.write8(math.Float64bits(x))
+}
+
+// isFinite reports whether x is neither NaN nor an infinity.
+func isFinite(x float64) bool {
+	return !math.IsNaN(x) && !math.IsInf(x, 0)
+}
+
 // EncodeUUID encodes the given UUID into the buffer.
 func (e *Encoder) EncodeUUID(x uuid.UUID) error {
 	return e.write(x[:])
 }
 
 // EncodeBytes encodes the given byte slice into the buffer. It writes the length of the
-// slice as a uint8 followed by the slice bytes.
+// slice, as a uint8 unless EncoderOptions.LenPrefix says otherwise, followed by the slice bytes.
 func (e *Encoder) EncodeBytes(b []byte) error {
-	if err := e.writeLen(len(b)); err != nil {
+	return e.EncodeBytesLen(b, 0)
+}
+
+// EncodeBytesLen encodes the given byte slice like EncodeBytes, with its length
+// encoded as an integer of the length prefix p.
+func (e *Encoder) EncodeBytesLen(b []byte, p LenPrefix) error {
+	if err := e.EncodeLen(len(b), p); err != nil {
 		return err
 	}
 
@@ -152,11 +375,150 @@ func (e *Encoder) EncodeString(s string) error {
 	return e.EncodeBytes(stringToBytes(s))
 }
 
+// EncodeStringLen encodes the given string like EncodeString, with its length
+// encoded as an integer of the length prefix p.
+func (e *Encoder) EncodeStringLen(s string, p LenPrefix) error {
+	return e.EncodeBytesLen(stringToBytes(s), p)
+}
+
+// EncodeBinary encodes the binary form of m, returned by its MarshalBinary
+// method, as a length prefixed byte slice like EncodeBytes.
+func (e *Encoder) EncodeBinary(m encoding.BinaryMarshaler) error {
+	return e.EncodeBinaryLen(m, 0)
+}
+
+// EncodeBinaryLen encodes the binary form of m like EncodeBinary, with its
+// length encoded as an integer of the length prefix p.
+func (e *Encoder) EncodeBinaryLen(m encoding.BinaryMarshaler, p LenPrefix) error {
+	b, err := m.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	return e.EncodeBytesLen(b, p)
+}
+
+// EncodeText encodes the text form of m, returned by its MarshalText method,
+// as a length prefixed string like EncodeString.
+func (e *Encoder) EncodeText(m encoding.TextMarshaler) error {
+	return e.EncodeTextLen(m, 0)
+}
+
+// EncodeTextLen encodes the text form of m like EncodeText, with its length
+// encoded as an integer of the length prefix p.
+func (e *Encoder) EncodeTextLen(m encoding.TextMarshaler, p LenPrefix) error {
+	b, err := m.MarshalText()
+	if err != nil {
+		return err
+	}
+
+	return e.EncodeBytesLen(b, p)
+}
+
 // EncodeDecimal encodes the given decimal into the buffer. It first shifts the decimal
-// by fixedDecimalPrecision and then encodes the resulting int64 using EncodeInt64.
+// by EncoderOptions.DecimalPrecision, 8 if not set, and then encodes the resulting int64
+// using EncodeInt64. With EncoderOptions.BigDecimal, it uses EncodeBigDecimal instead.
 func (e *Encoder) EncodeDecimal(d decimal.Decimal) error {
-	x := d.Shift(fixedDecimalPrecision).IntPart()
-	return e.EncodeInt64(x)
+	if e.opts.BigDecimal {
+		return e.EncodeBigDecimal(d)
+	}
+
+	prec := e.opts.DecimalPrecision
+	if prec == 0 {
+		prec = fixedDecimalPrecision
+	}
+
+	return e.EncodeDecimalPrec(d, prec)
+}
+
+// EncodeDecimalPrec encodes the given decimal like EncodeDecimal, shifted by prec,
+// which must be between 0 and MaxDecimalPrecision. Digits beyond the precision
+// are truncated. In strict mode, it returns ErrPrecisionLoss instead, and
+// ErrOverflow if the shifted decimal does not fit in an int64.
+func (e *Encoder) EncodeDecimalPrec(d decimal.Decimal, prec int32) error {
+	if err := checkDecimalPrec(prec); err != nil {
+		return err
+	}
+
+	if e.opts.Strict {
+		x, err := decimalToInt64(d, prec)
+		if err != nil {
+			return err
+		}
+
+		return e.EncodeInt64(x)
+	}
+
+	var b [8]byte
+	return e.write(AppendDecimalPrec(b[:0], d, prec))
+}
+
+// checkDecimalPrec returns an error if prec is not between 0 and MaxDecimalPrecision.
+func checkDecimalPrec(prec int32) error {
+	if prec < 0 || prec > MaxDecimalPrecision {
+		return fmt.Errorf("invalid decimal precision %d, the maximum is %d", prec, MaxDecimalPrecision)
+	}
+
+	return nil
+}
+
+// decimalToInt64 returns the decimal shifted by prec as an int64. It returns
+// ErrPrecisionLoss if the decimal has more than prec fractional digits, and
+// ErrOverflow if the shifted decimal does not fit in an int64.
+func decimalToInt64(d decimal.Decimal, prec int32) (int64, error) {
+	shifted := d.Shift(prec)
+	n := shifted.Truncate(0)
+	if !n.Equal(shifted) {
+		return 0, fmt.Errorf("%w: %s has more than %d decimal places", ErrPrecisionLoss, d, prec)
+	}
+
+	x := n.BigInt()
+	if !x.IsInt64() {
+		return 0, fmt.Errorf("%w: %s overflows int64 with %d decimal places", ErrOverflow, d, prec)
+	}
+
+	return x.Int64(), nil
+}
+
+// EncodeBigDecimal encodes the given decimal into the buffer without loss of precision,
+// as its coefficient encoded with EncodeBigInt followed by its exponent as a zigzag varint.
+func (e *Encoder) EncodeBigDecimal(d decimal.Decimal) error {
+	if err := e.EncodeBigInt(d.Coefficient()); err != nil {
+		return err
+	}
+
+	return e.EncodeVarint(int64(d.Exponent()))
+}
+
+// EncodeBigInt encodes the given integer into the buffer as a sign byte, 1 if it is
+// negative and 0 otherwise, followed by its absolute value in big-endian format,
+// encoded as a byte slice with EncodeBytes. The absolute value of zero is empty.
+func (e *Encoder) EncodeBigInt(x *big.Int) error {
+	if x == nil {
+		return fmt.Errorf("nil pointer: %T", x)
+	}
+
+	var sign uint8
+	if x.Sign() < 0 {
+		sign = 1
+	}
+
+	if err := e.write1(sign); err != nil {
+		return err
+	}
+
+	var b [32]byte
+	return e.EncodeBytes(bigIntBytes(x, b[:]))
+}
+
+// bigIntBytes returns the absolute value of x in big-endian format, in buf if it is large enough.
+func bigIntBytes(x *big.Int, buf []byte) []byte {
+	n := (x.BitLen() + 7) / 8
+	if n > len(buf) {
+		buf = make([]byte, n)
+	}
+
+	return x.FillBytes(buf[:n])
 }
 
 // EncodeBool encodes the given bool into the buffer as a single byte (1 for true, 0 for false).
@@ -169,6 +531,40 @@ func (e *Encoder) EncodeBool(b bool) error {
 }
 
 // EncodeTime encodes the given time into the buffer as an int64 representing the number of
+// nanoseconds elapsed since January 1, 1970 UTC, or of the EncoderOptions.TimeUnit if set.
 func (e *Encoder) EncodeTime(t time.Time) error {
-	return e.EncodeInt64(t.UnixNano())
+	return e.EncodeTimeUnit(t, 0)
+}
+
+// EncodeTimeUnit encodes the given time like EncodeTime, as a Unix timestamp in
+// the unit u, or in the default unit of the Encoder if u is zero.
+func (e *Encoder) EncodeTimeUnit(t time.Time, u TimeUnit) error {
+	x, err := e.TimeToUnix(t, u)
+	if err != nil {
+		return err
+	}
+
+	return e.EncodeInt64(x)
+}
+
+// TimeToUnix returns the given time as a Unix timestamp in the unit u, or in the
+// default unit of the Encoder if u is zero, as EncodeTimeUnit encodes it. It
+// truncates the time to the unit, in strict mode it returns ErrPrecisionLoss instead.
+func (e *Encoder) TimeToUnix(t time.Time, u TimeUnit) (int64, error) {
+	if u == 0 {
+		u = e.opts.TimeUnit
+	}
+
+	if e.opts.Strict && t.Nanosecond()%int(u.duration()) != 0 {
+		return 0, fmt.Errorf("%w: %s is more precise than %s", ErrPrecisionLoss, t, u)
+	}
+
+	switch u {
+	case TimeUnixMilli:
+		return t.UnixMilli(), nil
+	case TimeUnix:
+		return t.Unix(), nil
+	}
+
+	return t.UnixNano(), nil
 }
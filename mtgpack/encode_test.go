@@ -0,0 +1,69 @@
+package mtgpack
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failWriter accepts n bytes, then fails every write.
+type failWriter struct {
+	n int
+}
+
+func (w *failWriter) Write(b []byte) (int, error) {
+	if len(b) > w.n {
+		return 0, errors.New("write failed")
+	}
+
+	w.n -= len(b)
+	return len(b), nil
+}
+
+func TestStreamEncoder(t *testing.T) {
+	values := make([]interface{}, 0, 4000)
+	for i := 0; i < 1000; i++ {
+		values = append(values, uint16(i), uuid.New(), "route", decimal.NewFromInt(int64(i)))
+	}
+
+	t.Run("hash", func(t *testing.T) {
+		plain := NewEncoder()
+		require.NoError(t, plain.EncodeValues(values...))
+
+		var buf bytes.Buffer
+		enc := NewStreamEncoder(&buf)
+		require.NoError(t, enc.EncodeValues(values...))
+		assert.Less(t, enc.Len(), streamBufferSize)
+		assert.NotZero(t, buf.Len(), "flushed while encoding")
+		require.NoError(t, enc.Flush())
+		assert.Zero(t, enc.Len())
+		assert.Equal(t, plain.Bytes(), buf.Bytes())
+
+		h := sha256.New()
+		enc = NewStreamEncoder(h)
+		require.NoError(t, enc.EncodeValues(values...))
+		require.NoError(t, enc.Flush())
+		sum := sha256.Sum256(plain.Bytes())
+		assert.Equal(t, sum[:], h.Sum(nil))
+	})
+
+	t.Run("sticky error", func(t *testing.T) {
+		enc := NewStreamEncoder(&failWriter{n: streamBufferSize})
+		require.EqualError(t, enc.EncodeValues(values...), "write failed")
+		assert.EqualError(t, enc.EncodeUint8(1), "write failed")
+		assert.EqualError(t, enc.Flush(), "write failed")
+	})
+
+	t.Run("buffer", func(t *testing.T) {
+		enc := NewEncoder()
+		require.NoError(t, enc.EncodeUint16(1))
+		require.NoError(t, enc.Flush())
+		assert.Equal(t, []byte{0, 1}, enc.Bytes())
+	})
+}
@@ -1,8 +1,13 @@
 package mtgpack
 
 import (
+	"bytes"
+	"encoding"
 	"fmt"
+	"math/big"
 	"reflect"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/shopspring/decimal"
@@ -27,63 +32,544 @@ func EncodeValues(e *Encoder, values ...interface{}) error {
 }
 
 // EncodeValue encode a value to the encoder.
+//
+// Structs are encoded field by field in declaration order, see fieldTag for
+// the `mtg` tags that control how each field is encoded. A pointer passed to
+// EncodeValue is dereferenced, while pointers nested in structs, slices and
+// maps are encoded as optional values.
+//
+// Values whose type or pointer type implements CustomEncoder are encoded by
+// its EncodeMtg method. Otherwise values implementing encoding.BinaryMarshaler
+// and encoding.BinaryUnmarshaler are encoded as length prefixed byte slices,
+// except for the types with an encoding of their own like time.Time and uuid.UUID.
+//
+// The reflection work is done once per type: the encoder of each type is
+// compiled on first use and cached.
 func EncodeValue(e *Encoder, v interface{}) error {
+	if encoder, ok := v.(CustomEncoder); ok {
+		return encoder.EncodeMtg(e)
+	}
+
 	val := reflect.ValueOf(v)
-	typ := val.Type()
+	if !val.IsValid() {
+		return fmt.Errorf("%w: %T", ErrUnsupportedType, v)
+	}
 
-	if typ.Implements(customEncoderType) {
-		encoder := val.Interface().(CustomEncoder)
-		return encoder.EncodeMtg(e)
+	return e.registry().typeEncoder(val.Type())(e, val)
+}
+
+// encoderFunc encodes val, whose type is the type the function was compiled for.
+type encoderFunc func(e *Encoder, val reflect.Value) error
+
+// typeEncoder returns the cached encoder of values of type t, compiling it on
+// first use. Pointers are dereferenced and must not be nil, like the values
+// passed to EncodeValue.
+func (r *Registry) typeEncoder(t reflect.Type) encoderFunc {
+	if f, ok := r.encoders.Load(t); ok {
+		return f.(encoderFunc)
+	}
+
+	// Store an indirect func before compiling, so that recursive types
+	// refer to it instead of compiling themselves forever.
+	var (
+		wg sync.WaitGroup
+		f  encoderFunc
+	)
+
+	wg.Add(1)
+	fi, loaded := r.encoders.LoadOrStore(t, encoderFunc(func(e *Encoder, val reflect.Value) error {
+		wg.Wait()
+		return f(e, val)
+	}))
+	if loaded {
+		return fi.(encoderFunc)
+	}
+
+	f = r.newTypeEncoder(t)
+	wg.Done()
+	r.encoders.Store(t, f)
+	return f
+}
+
+func (r *Registry) newTypeEncoder(t reflect.Type) encoderFunc {
+	if t.Kind() != reflect.Pointer || t.Implements(customEncoderType) {
+		return r.newElemEncoder(t, fieldTag{})
+	}
+
+	elem := r.typeEncoder(t.Elem())
+	return func(e *Encoder, val reflect.Value) error {
+		if val.IsNil() {
+			return fmt.Errorf("nil pointer: %s", t)
+		}
+
+		return elem(e, val.Elem())
+	}
+}
+
+// newValueEncoder returns the encoder of values of type t nested in a struct,
+// slice or map. Pointers and fields tagged as optional are prefixed by a bool
+// that reports whether the value is present.
+func (r *Registry) newValueEncoder(t reflect.Type, tag fieldTag) encoderFunc {
+	if t.Kind() == reflect.Pointer {
+		var elem encoderFunc
+		if t.Implements(customEncoderType) {
+			elem = encodeCustom
+		} else {
+			enc := r.elemEncoder(t.Elem(), tag)
+			elem = func(e *Encoder, val reflect.Value) error {
+				return enc(e, val.Elem())
+			}
+		}
+
+		return func(e *Encoder, val reflect.Value) error {
+			if err := e.EncodeBool(!val.IsNil()); err != nil || val.IsNil() {
+				return err
+			}
+
+			return elem(e, val)
+		}
+	}
+
+	enc := r.elemEncoder(t, tag)
+	if !tag.optional {
+		return enc
+	}
+
+	isZero := zeroChecker(t)
+	return func(e *Encoder, val reflect.Value) error {
+		present := !isZero(val)
+		if err := e.EncodeBool(present); err != nil || !present {
+			return err
+		}
+
+		return enc(e, val)
+	}
+}
+
+// elemEncoder returns the encoder of values of type t with the given tag, the
+// cached one if the tag does not change how the value itself is encoded.
+func (r *Registry) elemEncoder(t reflect.Type, tag fieldTag) encoderFunc {
+	if !tag.changesElem() {
+		return r.typeEncoder(t)
+	}
+
+	return r.newElemEncoder(t, tag)
+}
+
+func (r *Registry) newElemEncoder(t reflect.Type, tag fieldTag) encoderFunc {
+	if implements(t, customEncoderType) {
+		return encodeCustom
+	}
+
+	if tag.text {
+		return newTextEncoder(tag.len)
+	}
+
+	if t == timeType && tag.changesElem() {
+		return r.newTimeEncoder(tag)
+	}
+
+	if tag.typ != nil {
+		return r.newOverrideEncoder(tag.typ, tag.varint)
+	}
+
+	if tag.varint {
+		return newVarintEncoder(t)
 	}
 
-	if typ.Kind() == reflect.Pointer {
-		typ = typ.Elem()
-		val = val.Elem()
+	if t == decimalType && tag.hasPrec {
+		return newDecimalPrecEncoder(tag.prec)
 	}
 
-	switch typ {
-	case decimalType:
-		d := val.Interface().(decimal.Decimal)
-		return e.EncodeDecimal(d)
-	case timeType:
-		t := val.Interface().(time.Time)
-		return e.EncodeTime(t)
+	if t == decimalType && tag.bigDecimal {
+		return encodeBigDecimalValue
+	}
+
+	// decimals, times, big integers and the types of RegisterType
+	if f, ok := r.lookup(t); ok {
+		return f.encode
 	}
 
 	// encode uuid.UUID
-	if size, ok := isByteArray(val); ok {
-		return encodeByteArrayValue(e, val, size)
+	if t.Kind() == reflect.Array && r.isBytes(t) {
+		return newByteArrayEncoder(t.Len())
+	}
+
+	if isBinaryType(t) {
+		return newBinaryEncoder(tag.len)
 	}
 
-	switch val.Kind() {
+	switch t.Kind() {
 	case reflect.Int, reflect.Int64:
-		return e.EncodeInt64(val.Int())
+		return func(e *Encoder, val reflect.Value) error {
+			return e.EncodeInt64(val.Int())
+		}
 	case reflect.Int8:
-		return e.EncodeInt8(int8(val.Int()))
+		return func(e *Encoder, val reflect.Value) error {
+			return e.EncodeInt8(int8(val.Int()))
+		}
 	case reflect.Int16:
-		return e.EncodeInt16(int16(val.Int()))
+		return func(e *Encoder, val reflect.Value) error {
+			return e.EncodeInt16(int16(val.Int()))
+		}
 	case reflect.Int32:
-		return e.EncodeInt32(int32(val.Int()))
+		return func(e *Encoder, val reflect.Value) error {
+			return e.EncodeInt32(int32(val.Int()))
+		}
 	case reflect.Uint, reflect.Uint64:
-		return e.EncodeUint64(val.Uint())
+		return func(e *Encoder, val reflect.Value) error {
+			return e.EncodeUint64(val.Uint())
+		}
 	case reflect.Uint8:
-		return e.EncodeUint8(uint8(val.Uint()))
+		return func(e *Encoder, val reflect.Value) error {
+			return e.EncodeUint8(uint8(val.Uint()))
+		}
 	case reflect.Uint16:
-		return e.EncodeUint16(uint16(val.Uint()))
+		return func(e *Encoder, val reflect.Value) error {
+			return e.EncodeUint16(uint16(val.Uint()))
+		}
 	case reflect.Uint32:
-		return e.EncodeUint32(uint32(val.Uint()))
+		return func(e *Encoder, val reflect.Value) error {
+			return e.EncodeUint32(uint32(val.Uint()))
+		}
+	case reflect.Float32:
+		return func(e *Encoder, val reflect.Value) error {
+			return e.EncodeFloat32(float32(val.Float()))
+		}
+	case reflect.Float64:
+		return func(e *Encoder, val reflect.Value) error {
+			return e.EncodeFloat64(val.Float())
+		}
 	case reflect.Bool:
-		return e.EncodeBool(val.Bool())
+		return func(e *Encoder, val reflect.Value) error {
+			return e.EncodeBool(val.Bool())
+		}
 	case reflect.String:
-		return e.EncodeString(val.String())
+		p := tag.len
+		return func(e *Encoder, val reflect.Value) error {
+			return e.EncodeStringLen(val.String(), p)
+		}
+	case reflect.Struct:
+		return r.newStructEncoder(t)
+	case reflect.Slice:
+		return r.newSliceEncoder(t, tag.len)
+	case reflect.Array:
+		return r.newArrayEncoder(t)
+	case reflect.Map:
+		return r.newMapEncoder(t, tag.len)
+	case reflect.Interface:
+		return newUnionEncoder(t)
+	}
+
+	return newErrorEncoder(fmt.Errorf("%w: %s", ErrUnsupportedType, t))
+}
+
+// newErrorEncoder returns an encoder that fails with err, for types that cannot be encoded.
+func newErrorEncoder(err error) encoderFunc {
+	return func(e *Encoder, val reflect.Value) error {
+		return err
+	}
+}
+
+// encodeCustom encodes a value that implements CustomEncoder, or whose
+// pointer does.
+func encodeCustom(e *Encoder, val reflect.Value) error {
+	return addressed(val).Interface().(CustomEncoder).EncodeMtg(e)
+}
+
+// addressed returns a pointer to val, which implements the methods of both
+// value and pointer receivers, or val itself if it is a pointer already. Values
+// that are not addressable, like the ones passed to EncodeValue, are copied.
+func addressed(val reflect.Value) reflect.Value {
+	switch {
+	case val.Kind() == reflect.Pointer:
+		return val
+	case val.CanAddr():
+		// converting the pointer to an interface does not allocate
+		return val.Addr()
+	}
+
+	ptr := reflect.New(val.Type())
+	ptr.Elem().Set(val)
+	return ptr
+}
+
+// newBinaryEncoder returns the encoder of values implementing
+// encoding.BinaryMarshaler, with the length prefix p.
+func newBinaryEncoder(p LenPrefix) encoderFunc {
+	return func(e *Encoder, val reflect.Value) error {
+		return e.EncodeBinaryLen(addressed(val).Interface().(encoding.BinaryMarshaler), p)
+	}
+}
+
+// newTextEncoder returns the encoder of values implementing
+// encoding.TextMarshaler, with the length prefix p.
+func newTextEncoder(p LenPrefix) encoderFunc {
+	return func(e *Encoder, val reflect.Value) error {
+		return e.EncodeTextLen(addressed(val).Interface().(encoding.TextMarshaler), p)
+	}
+}
+
+// newOverrideEncoder returns the encoder of integers encoded as the integer type typ.
+func (r *Registry) newOverrideEncoder(typ reflect.Type, varint bool) encoderFunc {
+	enc := r.newElemEncoder(typ, fieldTag{varint: varint})
+	return func(e *Encoder, val reflect.Value) error {
+		x := reflect.New(typ).Elem()
+		if err := setInt(x, val); err != nil {
+			return err
+		}
+
+		return enc(e, x)
+	}
+}
+
+// newVarintEncoder returns the encoder of a signed integer as a zigzag varint and
+// of an unsigned integer as a varint.
+func newVarintEncoder(t reflect.Type) encoderFunc {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return func(e *Encoder, val reflect.Value) error {
+			return e.EncodeVarint(val.Int())
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return func(e *Encoder, val reflect.Value) error {
+			return e.EncodeUvarint(val.Uint())
+		}
+	}
+
+	return newErrorEncoder(fmt.Errorf("%w: varint %s", ErrUnsupportedType, t))
+}
+
+func encodeDecimalValue(e *Encoder, val reflect.Value) error {
+	if val.CanAddr() {
+		return e.EncodeDecimal(*val.Addr().Interface().(*decimal.Decimal))
+	}
+
+	return e.EncodeDecimal(val.Interface().(decimal.Decimal))
+}
+
+// newDecimalPrecEncoder returns the encoder of decimals with the precision prec.
+func newDecimalPrecEncoder(prec int32) encoderFunc {
+	return func(e *Encoder, val reflect.Value) error {
+		if val.CanAddr() {
+			return e.EncodeDecimalPrec(*val.Addr().Interface().(*decimal.Decimal), prec)
+		}
+
+		return e.EncodeDecimalPrec(val.Interface().(decimal.Decimal), prec)
+	}
+}
+
+func encodeBigDecimalValue(e *Encoder, val reflect.Value) error {
+	if val.CanAddr() {
+		return e.EncodeBigDecimal(*val.Addr().Interface().(*decimal.Decimal))
+	}
+
+	return e.EncodeBigDecimal(val.Interface().(decimal.Decimal))
+}
+
+func encodeBigIntValue(e *Encoder, val reflect.Value) error {
+	if val.CanAddr() {
+		return e.EncodeBigInt(val.Addr().Interface().(*big.Int))
+	}
+
+	x := val.Interface().(big.Int)
+	return e.EncodeBigInt(&x)
+}
+
+func encodeTimeValue(e *Encoder, val reflect.Value) error {
+	return e.EncodeTime(timeValue(val))
+}
+
+// timeValue returns the time.Time held by val.
+func timeValue(val reflect.Value) time.Time {
+	if val.CanAddr() {
+		return *val.Addr().Interface().(*time.Time)
+	}
+
+	return val.Interface().(time.Time)
+}
+
+// newTimeEncoder returns the encoder of times with the unit and the integer
+// encoding selected by the tag.
+func (r *Registry) newTimeEncoder(tag fieldTag) encoderFunc {
+	unit := tag.timeUnit
+	if tag.typ == nil && !tag.varint {
+		return func(e *Encoder, val reflect.Value) error {
+			return e.EncodeTimeUnit(timeValue(val), unit)
+		}
+	}
+
+	typ := tag.typ
+	if typ == nil {
+		typ = overrideTypes["int64"]
+	}
+
+	enc := r.newOverrideEncoder(typ, tag.varint)
+	return func(e *Encoder, val reflect.Value) error {
+		x, err := e.TimeToUnix(timeValue(val), unit)
+		if err != nil {
+			return err
+		}
+
+		return enc(e, reflect.ValueOf(x))
+	}
+}
+
+// newByteArrayEncoder returns the encoder of byte arrays of the given size.
+func newByteArrayEncoder(size int) encoderFunc {
+	return func(e *Encoder, val reflect.Value) error {
+		if val.CanAddr() {
+			return e.write(val.Slice(0, size).Bytes())
+		}
+
+		var b []byte
+		if size <= 16 {
+			var scratch [16]byte
+			b = scratch[:size]
+		} else {
+			b = make([]byte, size)
+		}
+
+		for i := range b {
+			b[i] = byte(val.Index(i).Uint())
+		}
+
+		return e.write(b)
 	}
+}
+
+// newSliceEncoder returns the encoder of the length of a slice followed by its elements.
+func (r *Registry) newSliceEncoder(t reflect.Type, p LenPrefix) encoderFunc {
+	if r.isBytes(t) {
+		return func(e *Encoder, val reflect.Value) error {
+			return e.EncodeBytesLen(val.Bytes(), p)
+		}
+	}
+
+	elem := r.newValueEncoder(t.Elem(), fieldTag{})
+	return func(e *Encoder, val reflect.Value) error {
+		if err := e.EncodeLen(val.Len(), p); err != nil {
+			return err
+		}
+
+		for i := 0; i < val.Len(); i++ {
+			if err := elem(e, val.Index(i)); err != nil {
+				return err
+			}
+		}
 
-	return fmt.Errorf("unsupported type: %s", typ)
+		return nil
+	}
 }
 
-func encodeByteArrayValue(e *Encoder, val reflect.Value, size int) error {
-	b := make([]byte, size)
-	reflect.Copy(reflect.ValueOf(b), val)
-	_, err := e.Write(b)
-	return err
+// newArrayEncoder returns the encoder of the elements of an array. Arrays have
+// a fixed length, so no length prefix is written.
+func (r *Registry) newArrayEncoder(t reflect.Type) encoderFunc {
+	elem := r.newValueEncoder(t.Elem(), fieldTag{})
+	return func(e *Encoder, val reflect.Value) error {
+		for i := 0; i < val.Len(); i++ {
+			if err := elem(e, val.Index(i)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+// mapEntry is a map entry along with the encoded bytes of its key.
+type mapEntry struct {
+	key   []byte
+	value reflect.Value
+}
+
+// newMapEncoder returns the encoder of the length of a map followed by its
+// entries. The entries are sorted by the encoded bytes of their keys, so that
+// equal maps always produce identical bytes, which must differ between keys.
+func (r *Registry) newMapEncoder(t reflect.Type, p LenPrefix) encoderFunc {
+	key := r.newValueEncoder(t.Key(), fieldTag{})
+	value := r.newValueEncoder(t.Elem(), fieldTag{})
+	return func(e *Encoder, val reflect.Value) error {
+		if err := e.EncodeLen(val.Len(), p); err != nil {
+			return err
+		}
+
+		entries := make([]mapEntry, 0, val.Len())
+		iter := val.MapRange()
+		for iter.Next() {
+			b, err := encodeMapKey(e, key, iter.Key())
+			if err != nil {
+				return err
+			}
+
+			entries = append(entries, mapEntry{key: b, value: iter.Value()})
+		}
+
+		sort.Slice(entries, func(i, j int) bool {
+			return bytes.Compare(entries[i].key, entries[j].key) < 0
+		})
+
+		for i := 1; i < len(entries); i++ {
+			if bytes.Equal(entries[i-1].key, entries[i].key) {
+				return fmt.Errorf("%w: keys encoded as %x", ErrDuplicateKey, entries[i].key)
+			}
+		}
+
+		for _, entry := range entries {
+			if err := e.write(entry.key); err != nil {
+				return err
+			}
+
+			if err := value(e, entry.value); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+// encodeMapKey returns the bytes of a map key encoded by enc, with the options
+// and the Registry of the Encoder e.
+func encodeMapKey(e *Encoder, enc encoderFunc, key reflect.Value) ([]byte, error) {
+	ke := NewEncoder()
+	ke.SetOptions(e.opts)
+	ke.SetRegistry(e.types)
+	if err := enc(ke, key); err != nil {
+		return nil, err
+	}
+
+	return ke.Bytes(), nil
+}
+
+// fieldEncoder encodes a field of a struct.
+type fieldEncoder struct {
+	index int
+	enc   encoderFunc
+}
+
+// newStructEncoder returns the encoder of the fields of a struct in declaration order.
+func (r *Registry) newStructEncoder(t reflect.Type) encoderFunc {
+	fields, err := typeFields(t)
+	if err != nil {
+		return newErrorEncoder(err)
+	}
+
+	encoders := make([]fieldEncoder, 0, len(fields))
+	for _, f := range fields {
+		encoders = append(encoders, fieldEncoder{
+			index: f.index,
+			enc:   r.newValueEncoder(t.Field(f.index).Type, f.tag),
+		})
+	}
+
+	return func(e *Encoder, val reflect.Value) error {
+		for _, f := range encoders {
+			if err := f.enc(e, val.Field(f.index)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
 }
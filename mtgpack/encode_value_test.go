@@ -1,9 +1,15 @@
 package mtgpack
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"math"
+	"math/big"
 	"math/rand"
+	"net"
 	"reflect"
+	"sync"
 	"testing"
 	"time"
 
@@ -35,6 +41,8 @@ func TestEncodeValue(t *testing.T) {
 	fn(t, uint16(rand.Intn(math.MaxInt16)), 2)
 	fn(t, uint32(rand.Intn(math.MaxInt32)), 4)
 	fn(t, uint64(rand.Int63n(math.MaxInt64)), 8)
+	fn(t, rand.Float32(), 4)
+	fn(t, rand.NormFloat64(), 8)
 	fn(t, time.Date(2021, 2, 3, 4, 5, 6, 66565, time.Local), 8)
 	fn(t, "foo", 4)
 	fn(t, rand.Intn(2) == 1, 1)
@@ -43,3 +51,979 @@ func TestEncodeValue(t *testing.T) {
 
 	assert.Emptyf(t, enc.buf.Len(), "encoder has not remaining bytes")
 }
+
+type testHeader struct {
+	Version  uint8
+	Action   uint16
+	internal int //nolint:unused
+}
+
+type testOrder struct {
+	Header testHeader
+	Asset  uuid.UUID
+	Amount decimal.Decimal
+	Route  string
+	Count  int    `mtg:"uint8"`
+	Memo   string `mtg:"-"`
+}
+
+func TestEncodeStruct(t *testing.T) {
+	x := testOrder{
+		Header: testHeader{Version: 1, Action: 3},
+		Asset:  uuid.New(),
+		Amount: decimal.NewFromFloat(1.5),
+		Route:  "xvgf",
+		Count:  2,
+		Memo:   "skipped",
+	}
+
+	enc := NewEncoder()
+	require.NoError(t, EncodeValue(enc, x))
+
+	want := NewEncoder()
+	require.NoError(t, want.EncodeUint8(x.Header.Version))
+	require.NoError(t, want.EncodeUint16(x.Header.Action))
+	require.NoError(t, want.EncodeUUID(x.Asset))
+	require.NoError(t, want.EncodeDecimal(x.Amount))
+	require.NoError(t, want.EncodeString(x.Route))
+	require.NoError(t, want.EncodeUint8(uint8(x.Count)))
+	assert.Equal(t, want.Bytes(), enc.Bytes())
+
+	var y testOrder
+	require.NoError(t, DecodeValue(NewDecoder(enc.Bytes()), &y))
+	assert.Equal(t, x.Header.Version, y.Header.Version)
+	assert.Equal(t, x.Header.Action, y.Header.Action)
+	assert.Equal(t, x.Asset, y.Asset)
+	assert.Equal(t, x.Amount.String(), y.Amount.String())
+	assert.Equal(t, x.Route, y.Route)
+	assert.Equal(t, x.Count, y.Count)
+	assert.Empty(t, y.Memo)
+
+	t.Run("override overflow", func(t *testing.T) {
+		x.Count = 256
+		assert.Error(t, EncodeValue(NewEncoder(), x))
+	})
+
+	t.Run("invalid tag", func(t *testing.T) {
+		type invalid struct {
+			Name string `mtg:"uint8"`
+		}
+
+		assert.Error(t, EncodeValue(NewEncoder(), invalid{}))
+		assert.Error(t, DecodeValue(NewDecoder(nil), &invalid{}))
+	})
+}
+
+func TestEncodeSlice(t *testing.T) {
+	enc := NewEncoder()
+
+	fn := func(t *testing.T, x interface{}, size int) {
+		enc.Reset()
+		require.NoErrorf(t, EncodeValue(enc, x), "encode %T", x)
+		assert.Lenf(t, enc.Bytes(), size, "encode %T", x)
+		y := reflect.New(reflect.TypeOf(x)).Interface()
+		require.NoErrorf(t, DecodeValue(NewDecoder(enc.Bytes()), y), "decode %T", x)
+		assert.Equalf(t, x, reflect.ValueOf(y).Elem().Interface(), "decode %T", x)
+	}
+
+	fn(t, []uuid.UUID{uuid.New(), uuid.New()}, 1+2*16)
+	fn(t, []string{"foo", "", "bar"}, 1+4+1+4)
+	fn(t, []byte("hello"), 1+5)
+	fn(t, []uint16{}, 1)
+	fn(t, [3]uint16{1, 2, 3}, 6)
+	fn(t, [][]int8{{1, 2}, {3}}, 1+3+2)
+
+	t.Run("decimal", func(t *testing.T) {
+		x := []decimal.Decimal{decimal.NewFromInt(1), decimal.NewFromFloat(0.5)}
+		enc.Reset()
+		require.NoError(t, EncodeValue(enc, x))
+		assert.Len(t, enc.Bytes(), 1+2*8)
+
+		var y []decimal.Decimal
+		require.NoError(t, DecodeValue(NewDecoder(enc.Bytes()), &y))
+		require.Len(t, y, len(x))
+		for i := range x {
+			assert.True(t, x[i].Equal(y[i]))
+		}
+	})
+
+	t.Run("length prefix", func(t *testing.T) {
+		type batch struct {
+			Orders []uint8 `mtg:",len=uint16"`
+			Assets []uuid.UUID
+		}
+
+		x := batch{Orders: make([]uint8, 300), Assets: []uuid.UUID{uuid.New()}}
+		enc.Reset()
+		require.NoError(t, EncodeValue(enc, x))
+		assert.Len(t, enc.Bytes(), 2+300+1+16)
+
+		var y batch
+		require.NoError(t, DecodeValue(NewDecoder(enc.Bytes()), &y))
+		assert.Equal(t, x, y)
+	})
+
+	t.Run("too long", func(t *testing.T) {
+		assert.Error(t, EncodeValue(NewEncoder(), make([]uint16, 256)))
+	})
+}
+
+func TestEncodeMap(t *testing.T) {
+	x := map[uuid.UUID]int64{}
+	for i := 0; i < 10; i++ {
+		x[uuid.New()] = rand.Int63()
+	}
+
+	enc := NewEncoder()
+	require.NoError(t, EncodeValue(enc, x))
+	assert.Len(t, enc.Bytes(), 1+10*(16+8))
+
+	// encoding is deterministic regardless of map iteration order
+	for i := 0; i < 5; i++ {
+		again := NewEncoder()
+		require.NoError(t, EncodeValue(again, x))
+		assert.Equal(t, enc.Bytes(), again.Bytes())
+	}
+
+	var y map[uuid.UUID]int64
+	dec := NewDecoder(enc.Bytes())
+	dec.SetOptions(DecoderOptions{Strict: true})
+	require.NoError(t, DecodeValue(dec, &y))
+	assert.Equal(t, x, y)
+
+	t.Run("strict", func(t *testing.T) {
+		enc := NewEncoder()
+		require.NoError(t, enc.EncodeUint8(2))
+		require.NoError(t, enc.EncodeString("b"))
+		require.NoError(t, enc.EncodeUint8(1))
+		require.NoError(t, enc.EncodeString("a"))
+		require.NoError(t, enc.EncodeUint8(2))
+
+		var y map[string]uint8
+		require.NoError(t, DecodeValue(NewDecoder(enc.Bytes()), &y))
+		assert.Equal(t, map[string]uint8{"a": 2, "b": 1}, y)
+
+		dec := NewDecoder(enc.Bytes())
+		dec.SetOptions(DecoderOptions{Strict: true})
+		assert.Error(t, DecodeValue(dec, &y), "out of order")
+
+		enc.Reset()
+		require.NoError(t, enc.EncodeUint8(2))
+		require.NoError(t, enc.EncodeString("a"))
+		require.NoError(t, enc.EncodeUint8(1))
+		require.NoError(t, enc.EncodeString("a"))
+		require.NoError(t, enc.EncodeUint8(2))
+
+		dec = NewDecoder(enc.Bytes())
+		dec.SetOptions(DecoderOptions{Strict: true})
+		assert.Error(t, DecodeValue(dec, &y), "duplicated")
+	})
+
+	t.Run("duplicate keys", func(t *testing.T) {
+		type key struct {
+			A    uint8
+			B    uint8 `mtg:"-"`
+			note string
+		}
+
+		for _, m := range []interface{}{
+			map[key]uint8{{A: 1, B: 1}: 1, {A: 1, B: 2}: 2},
+			map[key]uint8{{A: 1, note: "a"}: 1, {A: 1, note: "b"}: 2},
+			map[float64]uint8{math.NaN(): 1, math.NaN(): 2},
+		} {
+			assert.ErrorIs(t, EncodeValue(NewEncoder(), m), ErrDuplicateKey, "encode %v", m)
+		}
+
+		encodeKey := func(e *Encoder, k key) error { return e.EncodeUint8(k.A) }
+		err := EncodeMap(NewEncoder(), map[key]uint8{{A: 1, B: 1}: 1, {A: 1, B: 2}: 2}, 0, encodeKey, (*Encoder).EncodeUint8)
+		assert.ErrorIs(t, err, ErrDuplicateKey)
+	})
+
+	t.Run("strict options", func(t *testing.T) {
+		// keys are checked with the encoding of the decoder options
+		long := map[string]uint8{string(bytes.Repeat([]byte{'a'}, 300)): 1, "b": 2}
+		tiny := map[decimal.Decimal]uint8{decimal.New(1, -18): 1, decimal.New(2, -18): 2}
+
+		for _, tc := range []struct {
+			opts EncoderOptions
+			x, y interface{}
+		}{
+			{EncoderOptions{LenPrefix: LenUint16}, long, &map[string]uint8{}},
+			{EncoderOptions{DecimalPrecision: 18}, tiny, &map[decimal.Decimal]uint8{}},
+		} {
+			enc := NewEncoder()
+			enc.SetOptions(tc.opts)
+			require.NoError(t, EncodeValue(enc, tc.x))
+
+			opts := DecoderOptions{Strict: true, LenPrefix: tc.opts.LenPrefix, DecimalPrecision: tc.opts.DecimalPrecision}
+			for _, dec := range []*Decoder{NewDecoder(enc.Bytes()), {Reader: bytes.NewReader(enc.Bytes())}} {
+				dec.SetOptions(opts)
+				require.NoError(t, DecodeValue(dec, tc.y))
+				// decimal keys hold pointers, so only the lengths are compared
+				assert.Equal(t, reflect.ValueOf(tc.x).Len(), reflect.ValueOf(tc.y).Elem().Len())
+			}
+		}
+
+		// swapped keys are detected when reading from an io.Reader too
+		b := []byte{2, 1, 'b', 1, 1, 'a', 2}
+		dec := &Decoder{Reader: bytes.NewReader(b)}
+		dec.SetOptions(DecoderOptions{Strict: true})
+		var y map[string]uint8
+		assert.ErrorIs(t, DecodeValue(dec, &y), ErrNonCanonical)
+	})
+}
+
+func TestEncodeOptional(t *testing.T) {
+	type header struct {
+		Version  uint8
+		FollowID uuid.UUID `mtg:",optional"`
+		Action   uint16
+	}
+
+	type params struct {
+		Slippage *decimal.Decimal
+		Referrer *uuid.UUID
+		Deadline time.Time `mtg:",optional"`
+		Limit    *int      `mtg:"uint16"`
+	}
+
+	t.Run("absent", func(t *testing.T) {
+		enc := NewEncoder()
+		require.NoError(t, EncodeValue(enc, header{Version: 1, Action: 3}))
+		assert.Equal(t, []byte{1, 0, 0, 3}, enc.Bytes())
+
+		y := header{FollowID: uuid.New()}
+		require.NoError(t, DecodeValue(NewDecoder(enc.Bytes()), &y))
+		assert.Equal(t, header{Version: 1, Action: 3}, y)
+
+		enc.Reset()
+		require.NoError(t, EncodeValue(enc, params{}))
+		assert.Equal(t, []byte{0, 0, 0, 0}, enc.Bytes())
+
+		var p params
+		require.NoError(t, DecodeValue(NewDecoder(enc.Bytes()), &p))
+		assert.Equal(t, params{}, p)
+	})
+
+	t.Run("present", func(t *testing.T) {
+		x := header{Version: 1, FollowID: uuid.New(), Action: 3}
+		enc := NewEncoder()
+		require.NoError(t, EncodeValue(enc, x))
+
+		want := append([]byte{1, 1}, x.FollowID[:]...)
+		want = append(want, 0, 3)
+		assert.Equal(t, want, enc.Bytes())
+
+		var y header
+		require.NoError(t, DecodeValue(NewDecoder(enc.Bytes()), &y))
+		assert.Equal(t, x, y)
+
+		slippage := decimal.NewFromFloat(0.01)
+		referrer := uuid.New()
+		limit := 500
+		p := params{
+			Slippage: &slippage,
+			Referrer: &referrer,
+			Deadline: time.Unix(1700000000, 0),
+			Limit:    &limit,
+		}
+
+		enc.Reset()
+		require.NoError(t, EncodeValue(enc, p))
+		assert.Len(t, enc.Bytes(), 1+8+1+16+1+8+1+2)
+
+		var q params
+		require.NoError(t, DecodeValue(NewDecoder(enc.Bytes()), &q))
+		require.NotNil(t, q.Slippage)
+		assert.True(t, slippage.Equal(*q.Slippage))
+		assert.Equal(t, p.Referrer, q.Referrer)
+		assert.True(t, p.Deadline.Equal(q.Deadline))
+		assert.Equal(t, p.Limit, q.Limit)
+	})
+}
+
+func TestEncodeFloat(t *testing.T) {
+	enc := NewEncoder()
+	require.NoError(t, enc.EncodeFloat64(1.5))
+	assert.Equal(t, []byte{0x3f, 0xf8, 0, 0, 0, 0, 0, 0}, enc.Bytes())
+
+	enc.Reset()
+	require.NoError(t, enc.EncodeFloat32(-2))
+	assert.Equal(t, []byte{0xc0, 0, 0, 0}, enc.Bytes())
+
+	t.Run("strict", func(t *testing.T) {
+		enc := NewEncoder()
+		require.NoError(t, enc.EncodeFloat64(math.NaN()))
+		require.NoError(t, enc.EncodeFloat32(float32(math.Inf(1))))
+
+		dec := NewDecoder(enc.Bytes())
+		dec.SetOptions(DecoderOptions{Strict: true})
+		_, err := dec.DecodeFloat64()
+		assert.Error(t, err)
+		_, err = dec.DecodeFloat32()
+		assert.Error(t, err)
+
+		enc.Reset()
+		enc.SetOptions(EncoderOptions{Strict: true})
+		assert.Error(t, enc.EncodeFloat64(math.Inf(-1)))
+		assert.Error(t, EncodeValue(enc, float32(math.NaN())))
+		assert.NoError(t, enc.EncodeFloat64(math.MaxFloat64))
+	})
+}
+
+func TestEncodeLenPrefix(t *testing.T) {
+	long := string(make([]byte, 300))
+
+	t.Run("too long", func(t *testing.T) {
+		assert.Error(t, NewEncoder().EncodeString(long))
+		assert.Error(t, NewEncoder().EncodeBytes([]byte(long)))
+	})
+
+	t.Run("options", func(t *testing.T) {
+		for _, p := range []LenPrefix{LenUint16, LenUint32, LenUvarint} {
+			enc := NewEncoder()
+			enc.SetOptions(EncoderOptions{LenPrefix: p})
+			require.NoErrorf(t, enc.EncodeString(long), "encode %s", p)
+			require.NoErrorf(t, EncodeValue(enc, []string{"a", "b"}), "encode %s", p)
+
+			dec := NewDecoder(enc.Bytes())
+			dec.SetOptions(DecoderOptions{LenPrefix: p})
+			s, err := dec.DecodeString()
+			require.NoErrorf(t, err, "decode %s", p)
+			assert.Equal(t, long, s)
+
+			var y []string
+			require.NoErrorf(t, DecodeValue(dec, &y), "decode %s", p)
+			assert.Equal(t, []string{"a", "b"}, y)
+		}
+	})
+
+	t.Run("tag", func(t *testing.T) {
+		type message struct {
+			Signature []byte `mtg:",len=uint16"`
+			Payload   string `mtg:",len=uvarint"`
+			Route     string
+		}
+
+		x := message{Signature: make([]byte, 256), Payload: long, Route: "xvgf"}
+		enc := NewEncoder()
+		require.NoError(t, EncodeValue(enc, x))
+		assert.Len(t, enc.Bytes(), 2+256+2+300+1+4)
+
+		var y message
+		require.NoError(t, DecodeValue(NewDecoder(enc.Bytes()), &y))
+		assert.Equal(t, x, y)
+	})
+}
+
+func TestEncodeDecimalPrec(t *testing.T) {
+	wei := decimal.RequireFromString("1.000000000000000001")
+
+	t.Run("truncate", func(t *testing.T) {
+		enc := NewEncoder()
+		require.NoError(t, enc.EncodeDecimal(wei))
+		assert.Equal(t, AppendInt64(nil, 1e8), enc.Bytes())
+
+		// silently overflows without strict mode
+		enc.Reset()
+		require.NoError(t, enc.EncodeDecimal(decimal.New(1, 11)))
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		enc := NewEncoder()
+		enc.SetOptions(EncoderOptions{Strict: true})
+		assert.ErrorIs(t, enc.EncodeDecimal(wei), ErrPrecisionLoss)
+		assert.ErrorIs(t, enc.EncodeDecimal(decimal.New(1, 11)), ErrOverflow)
+		assert.ErrorIs(t, enc.EncodeDecimalPrec(decimal.New(-1, 19), 0), ErrOverflow)
+		assert.NoError(t, enc.EncodeDecimal(decimal.RequireFromString("92233720368.54775807")))
+		assert.NoError(t, enc.EncodeDecimalPrec(wei, 18))
+	})
+
+	t.Run("options", func(t *testing.T) {
+		enc := NewEncoder()
+		enc.SetOptions(EncoderOptions{Strict: true, DecimalPrecision: 18})
+		require.NoError(t, EncodeValue(enc, wei))
+		assert.Equal(t, AppendInt64(nil, 1e18+1), enc.Bytes())
+
+		var y decimal.Decimal
+		dec := NewDecoder(enc.Bytes())
+		dec.SetOptions(DecoderOptions{DecimalPrecision: 18})
+		require.NoError(t, DecodeValue(dec, &y))
+		assert.True(t, wei.Equal(y))
+	})
+
+	t.Run("tag", func(t *testing.T) {
+		type transfer struct {
+			Amount decimal.Decimal  `mtg:",prec=18"`
+			Fee    *decimal.Decimal `mtg:",prec=0"`
+			Min    decimal.Decimal
+		}
+
+		fee := decimal.NewFromInt(3)
+		x := transfer{Amount: wei, Fee: &fee, Min: decimal.RequireFromString("0.1")}
+
+		enc := NewEncoder()
+		enc.SetOptions(EncoderOptions{Strict: true})
+		require.NoError(t, EncodeValue(enc, x))
+
+		want := AppendInt64(nil, 1e18+1)
+		want = AppendInt64(append(want, 1), 3)
+		want = AppendInt64(want, 1e7)
+		assert.Equal(t, want, enc.Bytes())
+
+		var y transfer
+		require.NoError(t, DecodeAll(NewDecoder(enc.Bytes()), &y))
+		assert.True(t, x.Amount.Equal(y.Amount))
+		assert.True(t, x.Fee.Equal(*y.Fee))
+		assert.True(t, x.Min.Equal(y.Min))
+
+		x.Amount = decimal.RequireFromString("1e-19")
+		assert.ErrorIs(t, EncodeValue(enc, x), ErrPrecisionLoss)
+	})
+
+	t.Run("invalid tag", func(t *testing.T) {
+		type invalid struct {
+			Amount decimal.Decimal `mtg:",prec=19"`
+		}
+
+		type notDecimal struct {
+			Amount int64 `mtg:",prec=8"`
+		}
+
+		assert.ErrorIs(t, EncodeValue(NewEncoder(), invalid{}), ErrInvalidTag)
+		assert.ErrorIs(t, EncodeValue(NewEncoder(), notDecimal{}), ErrInvalidTag)
+	})
+
+	t.Run("out of range", func(t *testing.T) {
+		x := decimal.New(15, -1)
+		for _, prec := range []int32{-3, MaxDecimalPrecision + 1, 30} {
+			enc := NewEncoder()
+			assert.Error(t, enc.EncodeDecimalPrec(x, prec), "encode with %d", prec)
+			assert.Empty(t, enc.Bytes())
+
+			_, err := NewDecoder(AppendInt64(nil, 15)).DecodeDecimalPrec(prec)
+			var de *DecodeError
+			assert.ErrorAs(t, err, &de, "decode with %d", prec)
+
+			// invalid options are not applied
+			enc.SetOptions(EncoderOptions{DecimalPrecision: 2})
+			assert.Error(t, enc.SetOptions(EncoderOptions{DecimalPrecision: prec}))
+			assert.EqualValues(t, 2, enc.Options().DecimalPrecision)
+
+			dec := NewDecoder(nil)
+			assert.Error(t, dec.SetOptions(DecoderOptions{DecimalPrecision: prec}))
+			assert.Zero(t, dec.Options().DecimalPrecision)
+		}
+
+		enc := NewEncoder()
+		require.NoError(t, enc.SetOptions(EncoderOptions{DecimalPrecision: MaxDecimalPrecision}))
+		require.NoError(t, enc.EncodeDecimal(x))
+		assert.Equal(t, AppendInt64(nil, 15e17), enc.Bytes())
+	})
+}
+
+func TestEncodeBigInt(t *testing.T) {
+	uint256 := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+
+	for _, tc := range []struct {
+		x    *big.Int
+		want []byte
+	}{
+		{big.NewInt(0), []byte{0, 0}},
+		{big.NewInt(255), []byte{0, 1, 0xff}},
+		{big.NewInt(-256), []byte{1, 2, 1, 0}},
+		{uint256, append([]byte{0, 32}, bytes.Repeat([]byte{0xff}, 32)...)},
+	} {
+		enc := NewEncoder()
+		require.NoError(t, enc.EncodeBigInt(tc.x))
+		assert.Equal(t, tc.want, enc.Bytes())
+
+		b, err := AppendBigInt(nil, tc.x)
+		require.NoError(t, err)
+		assert.Equal(t, tc.want, b)
+
+		dec := NewDecoder(enc.Bytes())
+		dec.SetOptions(DecoderOptions{Strict: true})
+		x, err := dec.DecodeBigInt()
+		require.NoError(t, err)
+		assert.Zero(t, tc.x.Cmp(x), "decode %s", tc.x)
+	}
+
+	t.Run("zero alloc", func(t *testing.T) {
+		enc := NewEncoder()
+		allocs := testing.AllocsPerRun(100, func() {
+			enc.Reset()
+			if err := enc.EncodeBigInt(uint256); err != nil {
+				t.Fatal(err)
+			}
+		})
+
+		assert.Zero(t, allocs)
+	})
+
+	t.Run("struct", func(t *testing.T) {
+		type supply struct {
+			Total  *big.Int
+			Burned *big.Int
+			Minted big.Int
+		}
+
+		x := supply{Total: uint256}
+		x.Minted.SetInt64(-7)
+
+		b, err := Marshal(x)
+		require.NoError(t, err)
+		assert.Equal(t, append(append([]byte{1, 0, 32}, bytes.Repeat([]byte{0xff}, 32)...), 0, 1, 1, 7), b)
+
+		y, err := Unmarshal[supply](b)
+		require.NoError(t, err)
+		assert.Zero(t, uint256.Cmp(y.Total))
+		assert.Nil(t, y.Burned)
+		assert.Equal(t, int64(-7), y.Minted.Int64())
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		for _, b := range [][]byte{
+			{0, 1, 0},    // leading zero
+			{1, 0},       // negative zero
+			{1, 2, 0, 1}, // leading zero
+		} {
+			_, err := NewDecoder(b).DecodeBigInt()
+			require.NoError(t, err)
+
+			dec := NewDecoder(b)
+			dec.SetOptions(DecoderOptions{Strict: true})
+			_, err = dec.DecodeBigInt()
+			assert.ErrorIs(t, err, ErrNonCanonical)
+
+			var de *DecodeError
+			require.ErrorAs(t, err, &de)
+			assert.Zero(t, de.Offset)
+		}
+
+		// invalid sign, after a byte
+		dec := NewDecoder([]byte{0, 2, 0})
+		require.NoError(t, dec.Skip(1))
+		_, err := dec.DecodeBigInt()
+		assert.ErrorIs(t, err, ErrNonCanonical)
+		var de *DecodeError
+		require.ErrorAs(t, err, &de)
+		assert.EqualValues(t, 1, de.Offset)
+	})
+}
+
+func TestEncodeBigDecimal(t *testing.T) {
+	supply := decimal.RequireFromString("123456789012345678901234567890.123456789012345678")
+
+	enc := NewEncoder()
+	require.NoError(t, enc.EncodeBigDecimal(supply))
+	b, err := AppendBigDecimal(nil, supply)
+	require.NoError(t, err)
+	assert.Equal(t, enc.Bytes(), b)
+
+	x, err := NewDecoder(b).DecodeBigDecimal()
+	require.NoError(t, err)
+	assert.Equal(t, supply, x)
+
+	t.Run("options", func(t *testing.T) {
+		enc := NewEncoder()
+		enc.SetOptions(EncoderOptions{BigDecimal: true})
+		require.NoError(t, EncodeValue(enc, supply))
+		assert.Equal(t, b, enc.Bytes())
+
+		var y decimal.Decimal
+		dec := NewDecoder(enc.Bytes())
+		dec.SetOptions(DecoderOptions{BigDecimal: true})
+		require.NoError(t, DecodeAll(dec, &y))
+		assert.Equal(t, supply, y)
+	})
+
+	t.Run("tag", func(t *testing.T) {
+		type token struct {
+			Supply decimal.Decimal `mtg:",big"`
+			Price  decimal.Decimal
+		}
+
+		x := token{Supply: supply, Price: decimal.New(15, -1)}
+		b, err := Marshal(x)
+		require.NoError(t, err)
+		want, err := AppendBigDecimal(nil, supply)
+		require.NoError(t, err)
+		assert.Equal(t, AppendInt64(want, 15e7), b)
+
+		y, err := Unmarshal[token](b)
+		require.NoError(t, err)
+		assert.Equal(t, supply, y.Supply)
+		assert.True(t, x.Price.Equal(y.Price))
+
+		type invalid struct {
+			Supply decimal.Decimal `mtg:",big,prec=18"`
+		}
+
+		assert.ErrorIs(t, EncodeValue(NewEncoder(), invalid{}), ErrInvalidTag)
+	})
+
+	t.Run("exponent overflow", func(t *testing.T) {
+		b := AppendVarint([]byte{0, 1, 1}, math.MaxInt32+1)
+		_, err := NewDecoder(b).DecodeBigDecimal()
+		assert.ErrorIs(t, err, ErrOverflow)
+
+		var de *DecodeError
+		require.ErrorAs(t, err, &de)
+		assert.EqualValues(t, 3, de.Offset)
+	})
+
+	t.Run("max exponent", func(t *testing.T) {
+		for _, exp := range []int64{200_000_000, -200_000_000} {
+			b := AppendVarint([]byte{0, 1, 1}, exp)
+			dec := NewDecoder(b)
+			dec.SetOptions(DecoderOptions{Strict: true, MaxBytes: 64, MaxDecimalExponent: 1000})
+			_, err := dec.DecodeBigDecimal()
+			assert.ErrorIs(t, err, ErrLimitExceeded, "exponent %d", exp)
+		}
+
+		b := AppendVarint([]byte{0, 1, 1}, -1000)
+		dec := NewDecoder(b)
+		dec.SetOptions(DecoderOptions{MaxDecimalExponent: 1000})
+		x, err := dec.DecodeBigDecimal()
+		require.NoError(t, err)
+		assert.Equal(t, decimal.New(1, -1000), x)
+	})
+}
+
+func TestEncodeTimeUnit(t *testing.T) {
+	deadline := time.Date(2024, 1, 2, 3, 4, 5, 0, time.FixedZone("UTC+8", 8*3600))
+
+	t.Run("units", func(t *testing.T) {
+		for _, tc := range []struct {
+			unit TimeUnit
+			want int64
+		}{
+			{0, deadline.UnixNano()},
+			{TimeUnixNano, deadline.UnixNano()},
+			{TimeUnixMilli, deadline.UnixMilli()},
+			{TimeUnix, deadline.Unix()},
+		} {
+			enc := NewEncoder()
+			enc.SetOptions(EncoderOptions{TimeUnit: tc.unit})
+			require.NoError(t, enc.EncodeTime(deadline))
+			assert.Equal(t, AppendInt64(nil, tc.want), enc.Bytes(), "encode %s", tc.unit)
+
+			dec := NewDecoder(enc.Bytes())
+			dec.SetOptions(DecoderOptions{TimeUnit: tc.unit, UTC: true})
+			got, err := dec.DecodeTime()
+			require.NoError(t, err)
+			assert.Equal(t, deadline.UTC(), got, "decode %s", tc.unit)
+			assert.Equal(t, time.UTC, got.Location())
+		}
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		precise := deadline.Add(time.Millisecond)
+
+		enc := NewEncoder()
+		require.NoError(t, enc.EncodeTimeUnit(precise, TimeUnix))
+		assert.Equal(t, AppendInt64(nil, deadline.Unix()), enc.Bytes())
+
+		enc.SetOptions(EncoderOptions{Strict: true})
+		assert.ErrorIs(t, enc.EncodeTimeUnit(precise, TimeUnix), ErrPrecisionLoss)
+		assert.NoError(t, enc.EncodeTimeUnit(precise, TimeUnixMilli))
+	})
+
+	t.Run("tag", func(t *testing.T) {
+		type swap struct {
+			Deadline time.Time  `mtg:"uint32,unix,utc"`
+			Created  time.Time  `mtg:",unixmilli,varint"`
+			Expires  *time.Time `mtg:",unix"`
+			Updated  time.Time
+		}
+
+		x := swap{
+			Deadline: deadline,
+			Created:  deadline.Add(time.Millisecond),
+			Expires:  &deadline,
+			Updated:  deadline.Add(time.Nanosecond),
+		}
+
+		b, err := Marshal(x)
+		require.NoError(t, err)
+
+		want := AppendUint32(nil, uint32(deadline.Unix()))
+		want = AppendVarint(want, deadline.UnixMilli()+1)
+		want = AppendInt64(append(want, 1), deadline.Unix())
+		want = AppendInt64(want, deadline.UnixNano()+1)
+		assert.Equal(t, want, b)
+
+		y, err := Unmarshal[swap](b)
+		require.NoError(t, err)
+		assert.Equal(t, deadline.UTC(), y.Deadline)
+		assert.True(t, x.Created.Equal(y.Created))
+		assert.True(t, x.Expires.Equal(*y.Expires))
+		assert.True(t, x.Updated.Equal(y.Updated))
+
+		x.Deadline = time.Unix(-1, 0)
+		_, err = Marshal(x)
+		assert.ErrorIs(t, err, ErrOverflow)
+	})
+
+	t.Run("invalid tag", func(t *testing.T) {
+		type invalid struct {
+			Count int64 `mtg:",unix"`
+		}
+
+		assert.ErrorIs(t, EncodeValue(NewEncoder(), invalid{}), ErrInvalidTag)
+	})
+}
+
+// testVersion is encoded by its MarshalBinary and MarshalText methods.
+type testVersion struct {
+	Major, Minor uint8
+}
+
+func (v testVersion) MarshalBinary() ([]byte, error) {
+	return []byte{v.Major, v.Minor}, nil
+}
+
+func (v *testVersion) UnmarshalBinary(b []byte) error {
+	if len(b) != 2 {
+		return fmt.Errorf("invalid version length %d", len(b))
+	}
+
+	v.Major, v.Minor = b[0], b[1]
+	return nil
+}
+
+func (v testVersion) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("%d.%d", v.Major, v.Minor)), nil
+}
+
+func (v *testVersion) UnmarshalText(b []byte) error {
+	_, err := fmt.Sscanf(string(b), "%d.%d", &v.Major, &v.Minor)
+	return err
+}
+
+// testMarshalOnly has a MarshalBinary method but no UnmarshalBinary method.
+type testMarshalOnly struct {
+	A, B uint8
+}
+
+func (m testMarshalOnly) MarshalBinary() ([]byte, error) {
+	return []byte{9, m.A, m.B}, nil
+}
+
+// testUnmarshalOnly has an UnmarshalBinary method but no MarshalBinary method.
+type testUnmarshalOnly struct {
+	A, B uint8
+}
+
+func (m *testUnmarshalOnly) UnmarshalBinary(b []byte) error {
+	return errors.New("unexpected UnmarshalBinary call")
+}
+
+// testAmount implements CustomEncoder and CustomDecoder on pointer receivers.
+type testAmount struct {
+	Value uint64
+}
+
+func (a *testAmount) EncodeMtg(e *Encoder) error {
+	return e.EncodeUvarint(a.Value)
+}
+
+func (a *testAmount) DecodeMtg(d *Decoder) error {
+	var err error
+	a.Value, err = d.DecodeUvarint()
+	return err
+}
+
+func TestEncodeMarshaler(t *testing.T) {
+	t.Run("binary", func(t *testing.T) {
+		type release struct {
+			Version testVersion
+			Min     *testVersion `mtg:",len=uint16"`
+			Asset   uuid.UUID
+			Created time.Time
+		}
+
+		x := release{
+			Version: testVersion{Major: 1, Minor: 2},
+			Min:     &testVersion{Major: 1},
+			Asset:   uuid.New(),
+			Created: time.Unix(1700000000, 0),
+		}
+
+		b, err := Marshal(x)
+		require.NoError(t, err)
+
+		// uuid.UUID and time.Time keep their own encodings
+		want := []byte{2, 1, 2, 1, 0, 2, 1, 0}
+		want = AppendUUID(want, x.Asset)
+		want = AppendTime(want, x.Created)
+		assert.Equal(t, want, b)
+
+		y, err := Unmarshal[release](b)
+		require.NoError(t, err)
+		assert.Equal(t, x.Version, y.Version)
+		assert.Equal(t, x.Min, y.Min)
+		assert.Equal(t, x.Asset, y.Asset)
+
+		dec := NewDecoder(b)
+		require.NoError(t, dec.SkipValue(reflect.TypeOf(x)))
+		assert.Zero(t, dec.Remaining())
+
+		b, err = Marshal(testVersion{Major: 3, Minor: 4})
+		require.NoError(t, err)
+		assert.Equal(t, []byte{2, 3, 4}, b)
+
+		_, err = Unmarshal[testVersion]([]byte{1, 3})
+		assert.ErrorContains(t, err, "invalid version length 1")
+	})
+
+	t.Run("one-sided binary", func(t *testing.T) {
+		// types with only one of the methods are encoded by their fields on both sides
+		type pair struct {
+			X testMarshalOnly
+			Y testUnmarshalOnly
+			Z uint8
+		}
+
+		x := pair{X: testMarshalOnly{A: 3, B: 1}, Y: testUnmarshalOnly{A: 4, B: 5}, Z: 2}
+		b, err := Marshal(x)
+		require.NoError(t, err)
+		assert.Equal(t, []byte{3, 1, 4, 5, 2}, b)
+
+		y, err := Unmarshal[pair](b)
+		require.NoError(t, err)
+		assert.Equal(t, x, y)
+
+		dec := NewDecoder(b)
+		require.NoError(t, dec.SkipValue(reflect.TypeOf(x)))
+		assert.Zero(t, dec.Remaining())
+
+		type prefixed struct {
+			X testMarshalOnly `mtg:",len=uint16"`
+		}
+
+		_, err = Marshal(prefixed{})
+		assert.ErrorIs(t, err, ErrInvalidTag)
+	})
+
+	t.Run("text", func(t *testing.T) {
+		type peer struct {
+			Version testVersion `mtg:",text"`
+			Addr    net.IP      `mtg:",text,len=uint16"`
+		}
+
+		x := peer{Version: testVersion{Major: 1, Minor: 12}, Addr: net.ParseIP("10.0.0.1")}
+		b, err := Marshal(x)
+		require.NoError(t, err)
+		assert.Equal(t, append([]byte("\x041.12\x00\x08"), "10.0.0.1"...), b)
+
+		y, err := Unmarshal[peer](b)
+		require.NoError(t, err)
+		assert.Equal(t, x.Version, y.Version)
+		assert.True(t, x.Addr.Equal(y.Addr))
+
+		dec := NewDecoder(b)
+		require.NoError(t, dec.SkipValue(reflect.TypeOf(x)))
+		assert.Zero(t, dec.Remaining())
+	})
+
+	t.Run("pointer receiver", func(t *testing.T) {
+		type payment struct {
+			Amount testAmount
+			Fees   []testAmount
+		}
+
+		x := payment{Amount: testAmount{Value: 300}, Fees: []testAmount{{Value: 1}}}
+		b, err := Marshal(x)
+		require.NoError(t, err)
+		assert.Equal(t, []byte{0xac, 0x02, 1, 1}, b)
+
+		y, err := Unmarshal[payment](b)
+		require.NoError(t, err)
+		assert.Equal(t, x, y)
+
+		// values passed to EncodeValue are encoded by the methods of their pointers
+		enc := NewEncoder()
+		require.NoError(t, EncodeValue(enc, x.Amount))
+		assert.Equal(t, []byte{0xac, 0x02}, enc.Bytes())
+	})
+
+	t.Run("invalid tag", func(t *testing.T) {
+		type notText struct {
+			Header testHeader `mtg:",text"`
+		}
+
+		type notBinary struct {
+			Header testHeader `mtg:",len=uint16"`
+		}
+
+		assert.ErrorIs(t, EncodeValue(NewEncoder(), notText{}), ErrInvalidTag)
+		assert.ErrorIs(t, EncodeValue(NewEncoder(), notBinary{}), ErrInvalidTag)
+	})
+}
+
+type testNode struct {
+	Value    uint8
+	Next     *testNode
+	Children []testNode
+}
+
+func TestEncodeRecursive(t *testing.T) {
+	x := testNode{
+		Value:    1,
+		Next:     &testNode{Value: 2, Children: []testNode{}},
+		Children: []testNode{{Value: 3, Children: []testNode{}}},
+	}
+
+	want := []byte{
+		1,       // Value
+		1, 2, 0, // Next
+		0,
+		1,       // Children
+		3, 0, 0, // Children[0]
+	}
+
+	// the first use of the type compiles its encoder and decoder concurrently
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			enc := NewEncoder()
+			if assert.NoError(t, EncodeValue(enc, x)) {
+				assert.Equal(t, want, enc.Bytes())
+			}
+
+			var y testNode
+			if assert.NoError(t, DecodeAll(NewDecoder(want), &y)) {
+				assert.Equal(t, x, y)
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+func BenchmarkEncodeStruct(b *testing.B) {
+	x := testOrder{
+		Header: testHeader{Version: 1, Action: 3},
+		Asset:  uuid.New(),
+		Amount: decimal.NewFromFloat(1.5),
+		Route:  "xvgf",
+		Count:  2,
+	}
+
+	enc := NewEncoder()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		enc.Reset()
+		if err := enc.EncodeValue(&x); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package mtgpack
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrUnexpectedEOF is returned when the input ends in the middle of a value.
+	ErrUnexpectedEOF = io.ErrUnexpectedEOF
+
+	// ErrTooLong is returned when a length does not fit in its length prefix.
+	ErrTooLong = errors.New("too long")
+
+	// ErrUnsupportedType is returned for types that cannot be encoded or decoded.
+	ErrUnsupportedType = errors.New("unsupported type")
+
+	// ErrTrailingBytes is returned when input remains after the last value is decoded.
+	ErrTrailingBytes = errors.New("trailing bytes")
+
+	// ErrOverflow is returned when a number does not fit in the type it is encoded or decoded as.
+	ErrOverflow = errors.New("overflow")
+
+	// ErrPrecisionLoss is returned in strict mode for decimals with more fractional
+	// digits than the precision they are encoded with.
+	ErrPrecisionLoss = errors.New("precision loss")
+
+	// ErrNonFinite is returned for NaN and infinite floats in strict mode.
+	ErrNonFinite = errors.New("non-finite float")
+
+	// ErrNonCanonical is returned in strict mode for input that is not in canonical form.
+	ErrNonCanonical = errors.New("non-canonical encoding")
+
+	// ErrUnknownVariant is returned when decoding a union with a discriminator
+	// that is not registered, see RegisterUnion.
+	ErrUnknownVariant = errors.New("unknown union variant")
+
+	// ErrLimitExceeded is returned when the input exceeds one of the limits set
+	// in DecoderOptions.
+	ErrLimitExceeded = errors.New("limit exceeded")
+
+	// ErrInvalidTag is returned for struct fields with a malformed `mtg` tag.
+	ErrInvalidTag = errors.New("invalid mtg tag")
+
+	// ErrDuplicateKey is returned when distinct keys of a map encode to the same
+	// bytes, like structs that differ only in fields that are not encoded, or NaN
+	// floats, as the map would not decode back.
+	ErrDuplicateKey = errors.New("duplicate map key")
+)
+
+// DecodeError describes a failure to decode a value. It wraps one of the errors
+// above, or an error returned by a CustomDecoder, and can be inspected with
+// errors.Is and errors.As.
+type DecodeError struct {
+	// Offset is the offset in bytes from the start of the input of the value that failed.
+	Offset int64
+	// Path is the path of the value that failed, like "Params[2].Min". It is empty
+	// for values decoded directly rather than as part of a struct, slice or map.
+	Path string
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("mtgpack: decode at offset %d: %v", e.Offset, e.Err)
+	}
+
+	return fmt.Sprintf("mtgpack: decode %s at offset %d: %v", e.Path, e.Offset, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// pathElem is an element of the path of the value being decoded.
+type pathElem struct {
+	field string        // struct field name, empty for elements
+	index int           // index of a slice or array element
+	key   reflect.Value // key of a map entry, if valid
+
+	offset int64 // offset of the value, for trace spans
+}
+
+// formatPath formats the path elements as a string like "Params[2].Min".
+func formatPath(path []pathElem) string {
+	var sb strings.Builder
+	for _, elem := range path {
+		switch {
+		case elem.field != "":
+			if sb.Len() > 0 {
+				sb.WriteByte('.')
+			}
+
+			sb.WriteString(elem.field)
+		case elem.key.IsValid():
+			fmt.Fprintf(&sb, "[%v]", elem.key)
+		default:
+			sb.WriteByte('[')
+			sb.WriteString(strconv.Itoa(elem.index))
+			sb.WriteByte(']')
+		}
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,110 @@
+package mtgpack
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeError(t *testing.T) {
+	type param struct {
+		Asset uuid.UUID
+		Min   decimal.Decimal
+	}
+
+	type action struct {
+		Action uint16
+		Params []param
+	}
+
+	x := action{
+		Action: 3,
+		Params: []param{
+			{Asset: uuid.New(), Min: decimal.NewFromInt(1)},
+			{Asset: uuid.New(), Min: decimal.NewFromInt(2)},
+			{Asset: uuid.New(), Min: decimal.NewFromInt(3)},
+		},
+	}
+
+	enc := NewEncoder()
+	require.NoError(t, EncodeValue(enc, x))
+
+	t.Run("truncated", func(t *testing.T) {
+		b := enc.Bytes()[:enc.Len()-8]
+
+		var y action
+		err := DecodeValue(NewDecoder(b), &y)
+		assert.ErrorIs(t, err, ErrUnexpectedEOF)
+
+		var de *DecodeError
+		require.True(t, errors.As(err, &de))
+		assert.Equal(t, "Params[2].Min", de.Path)
+		assert.EqualValues(t, 2+1+2*24+16, de.Offset)
+		assert.EqualError(t, err, "mtgpack: decode Params[2].Min at offset 67: unexpected EOF")
+	})
+
+	t.Run("primitive", func(t *testing.T) {
+		dec := NewDecoder([]byte{1, 2})
+		_, err := dec.DecodeUint16()
+		require.NoError(t, err)
+		_, err = dec.DecodeUint16()
+		assert.ErrorIs(t, err, ErrUnexpectedEOF)
+
+		var de *DecodeError
+		require.True(t, errors.As(err, &de))
+		assert.EqualValues(t, 2, de.Offset)
+		assert.Empty(t, de.Path)
+	})
+
+	t.Run("overflow", func(t *testing.T) {
+		type small struct {
+			Count int8 `mtg:"uint16"`
+		}
+
+		var y small
+		err := DecodeValue(NewDecoder([]byte{1, 0}), &y)
+		assert.ErrorIs(t, err, ErrOverflow)
+
+		var de *DecodeError
+		require.True(t, errors.As(err, &de))
+		assert.Equal(t, "Count", de.Path)
+		assert.EqualValues(t, 0, de.Offset)
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		var c chan int
+		assert.ErrorIs(t, EncodeValue(NewEncoder(), c), ErrUnsupportedType)
+		assert.ErrorIs(t, DecodeValue(NewDecoder(nil), &c), ErrUnsupportedType)
+	})
+
+	t.Run("too long", func(t *testing.T) {
+		assert.ErrorIs(t, NewEncoder().EncodeBytes(make([]byte, 256)), ErrTooLong)
+	})
+
+	t.Run("invalid tag", func(t *testing.T) {
+		type invalid struct {
+			Name string `mtg:",foo"`
+		}
+
+		assert.ErrorIs(t, EncodeValue(NewEncoder(), invalid{}), ErrInvalidTag)
+	})
+
+	t.Run("map key", func(t *testing.T) {
+		b := []byte{2, 1, 'b', 0, 1, 'a', 0}
+		dec := NewDecoder(b)
+		dec.SetOptions(DecoderOptions{Strict: true})
+
+		var m map[string]uint8
+		err := DecodeValue(dec, &m)
+		assert.ErrorIs(t, err, ErrNonCanonical)
+
+		var de *DecodeError
+		require.True(t, errors.As(err, &de))
+		assert.Equal(t, "[a]", de.Path)
+		assert.EqualValues(t, 4, de.Offset)
+	})
+}
@@ -0,0 +1,150 @@
+package mtgpack
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"unsafe"
+)
+
+// The functions in this file implement the parts of the encoding that are not
+// expressible with the Encoder and Decoder methods alone, so that code generated
+// by mtgpackgen stays byte-compatible with EncodeValue without using reflection.
+
+// integer is the set of integer types.
+type integer interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 | ~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64
+}
+
+// ConvertInt converts the integer x to the type T. It returns ErrOverflow if x
+// does not fit in T.
+func ConvertInt[T, S integer](x S) (T, error) {
+	y := T(x)
+	if S(y) != x || (x < 0) != (y < 0) {
+		return 0, fmt.Errorf("%w: value %d overflows %T", ErrOverflow, x, y)
+	}
+
+	return y, nil
+}
+
+// mapItem is a map entry along with the encoded bytes of its key.
+type mapItem[V any] struct {
+	key   []byte
+	value V
+}
+
+// EncodeMap encodes the length of m, as an integer of the length prefix p, followed
+// by its entries sorted by the encoded bytes of their keys, like EncodeValue does.
+// It returns ErrDuplicateKey if two keys encode to the same bytes.
+func EncodeMap[K comparable, V any](e *Encoder, m map[K]V, p LenPrefix, encodeKey func(*Encoder, K) error, encodeValue func(*Encoder, V) error) error {
+	if err := e.EncodeLen(len(m), p); err != nil {
+		return err
+	}
+
+	items := make([]mapItem[V], 0, len(m))
+	for k, v := range m {
+		enc := NewEncoder()
+		enc.SetOptions(e.opts)
+		enc.SetRegistry(e.types)
+		if err := encodeKey(enc, k); err != nil {
+			return err
+		}
+
+		items = append(items, mapItem[V]{key: enc.Bytes(), value: v})
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return bytes.Compare(items[i].key, items[j].key) < 0
+	})
+
+	for i := 1; i < len(items); i++ {
+		if bytes.Equal(items[i-1].key, items[i].key) {
+			return fmt.Errorf("%w: keys encoded as %x", ErrDuplicateKey, items[i].key)
+		}
+	}
+
+	for _, item := range items {
+		if err := e.write(item.key); err != nil {
+			return err
+		}
+
+		if err := encodeValue(e, item.value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MakeSlice returns an empty slice with room for some of the n elements of a
+// length prefix decoded by d, for generated DecodeMtg methods that append them
+// as they are decoded, so that a length prefix alone cannot allocate much. With
+// DecoderOptions.ReuseSlices, it returns s emptied if it has room for all of them.
+// It returns ErrLimitExceeded if the elements have size 0 and n exceeds the
+// DecoderOptions.MaxBytes of d, as they are not read from the input.
+func MakeSlice[S ~[]E, E any](d *Decoder, s S, n int) (S, error) {
+	var e E
+	if err := d.checkZeroSize(n, unsafe.Sizeof(e)); err != nil {
+		return nil, err
+	}
+
+	if d.opts.ReuseSlices && cap(s) >= n {
+		return s[:0], nil
+	}
+
+	return make(S, 0, preallocLen(n, unsafe.Sizeof(e))), nil
+}
+
+// DecodeMap decodes a map encoded by EncodeMap, with its length encoded as an
+// integer of the length prefix p. In strict mode, keys must be unique and sorted
+// by the bytes they are decoded from.
+func DecodeMap[K comparable, V any](d *Decoder, p LenPrefix, decodeKey func(*Decoder, *K) error, decodeValue func(*Decoder, *V) error) (map[K]V, error) {
+	n, err := d.DecodeLen(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		k K
+		v V
+	)
+
+	size := unsafe.Sizeof(k) + unsafe.Sizeof(v)
+	if err := d.checkZeroSize(n, size); err != nil {
+		return nil, err
+	}
+
+	m := make(map[K]V, preallocLen(n, size))
+
+	var prev []byte
+	for i := 0; i < n; i++ {
+		offset := d.off
+
+		var key K
+		b, err := d.captureRead(func() error {
+			return decodeKey(d, &key)
+		})
+		if err != nil {
+			return nil, d.wrapError(offset, err)
+		}
+
+		if d.opts.Strict {
+			if i > 0 && bytes.Compare(prev, b) >= 0 {
+				return nil, d.wrapError(offset, fmt.Errorf("%w: map key is duplicated or out of order", ErrNonCanonical))
+			}
+
+			prev = b
+		}
+
+		offset = d.off
+
+		var value V
+		if err := decodeValue(d, &value); err != nil {
+			return nil, d.wrapError(offset, err)
+		}
+
+		m[key] = value
+	}
+
+	return m, nil
+}
@@ -0,0 +1,118 @@
+package mtgpack
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertInt(t *testing.T) {
+	u, err := ConvertInt[uint8](255)
+	require.NoError(t, err)
+	assert.Equal(t, uint8(255), u)
+
+	i, err := ConvertInt[int64](uint64(1 << 62))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1<<62), i)
+
+	_, err = ConvertInt[uint8](256)
+	assert.ErrorIs(t, err, ErrOverflow)
+
+	_, err = ConvertInt[uint64](-1)
+	assert.ErrorIs(t, err, ErrOverflow)
+
+	_, err = ConvertInt[int64](uint64(1 << 63))
+	assert.ErrorIs(t, err, ErrOverflow)
+}
+
+func TestGenericMap(t *testing.T) {
+	encodeKey := func(e *Encoder, k string) error { return e.EncodeString(k) }
+	encodeValue := func(e *Encoder, v uint8) error { return e.EncodeUint8(v) }
+	decodeKey := func(d *Decoder, k *string) (err error) { *k, err = d.DecodeString(); return }
+	decodeValue := func(d *Decoder, v *uint8) (err error) { *v, err = d.DecodeUint8(); return }
+
+	m := map[string]uint8{"bb": 1, "a": 2, "c": 3}
+
+	want := NewEncoder()
+	require.NoError(t, EncodeValue(want, m))
+
+	got := NewEncoder()
+	require.NoError(t, EncodeMap(got, m, 0, encodeKey, encodeValue))
+	assert.Equal(t, want.Bytes(), got.Bytes())
+
+	d := NewDecoder(got.Bytes())
+	d.SetOptions(DecoderOptions{Strict: true})
+	decoded, err := DecodeMap(d, 0, decodeKey, decodeValue)
+	require.NoError(t, err)
+	assert.Equal(t, m, decoded)
+
+	// keys out of order
+	b := []byte{2, 1, 'b', 1, 1, 'a', 2}
+	_, err = DecodeMap(NewDecoder(b), 0, decodeKey, decodeValue)
+	require.NoError(t, err)
+
+	d = NewDecoder(b)
+	d.SetOptions(DecoderOptions{Strict: true})
+	_, err = DecodeMap(d, 0, decodeKey, decodeValue)
+	assert.ErrorIs(t, err, ErrNonCanonical)
+
+	d = &Decoder{Reader: bytes.NewReader(b)}
+	d.SetOptions(DecoderOptions{Strict: true})
+	_, err = DecodeMap(d, 0, decodeKey, decodeValue)
+	assert.ErrorIs(t, err, ErrNonCanonical)
+
+	t.Run("options", func(t *testing.T) {
+		// keys are checked with the encoding of the decoder options
+		m := map[string]uint8{strings.Repeat("a", 300): 1, "b": 2}
+		e := NewEncoder()
+		e.SetOptions(EncoderOptions{LenPrefix: LenUint16})
+		require.NoError(t, EncodeMap(e, m, 0, encodeKey, encodeValue))
+
+		for _, d := range []*Decoder{NewDecoder(e.Bytes()), {Reader: bytes.NewReader(e.Bytes())}} {
+			d.SetOptions(DecoderOptions{Strict: true, LenPrefix: LenUint16})
+			decoded, err := DecodeMap(d, 0, decodeKey, decodeValue)
+			require.NoError(t, err)
+			assert.Equal(t, m, decoded)
+		}
+
+		tiny := map[decimal.Decimal]uint8{decimal.New(1, -18): 1, decimal.New(2, -18): 2}
+		e = NewEncoder()
+		e.SetOptions(EncoderOptions{DecimalPrecision: 18})
+		require.NoError(t, EncodeMap(e, tiny, 0, (*Encoder).EncodeDecimal, encodeValue))
+
+		d := NewDecoder(e.Bytes())
+		d.SetOptions(DecoderOptions{Strict: true, DecimalPrecision: 18})
+		decoded, err := DecodeMap(d, 0, func(d *Decoder, k *decimal.Decimal) (err error) { *k, err = d.DecodeDecimal(); return }, decodeValue)
+		require.NoError(t, err)
+		assert.Len(t, decoded, 2)
+	})
+}
+
+func TestMakeSlice(t *testing.T) {
+	d := NewDecoder(nil)
+	d.SetOptions(DecoderOptions{MaxBytes: 100})
+
+	s, err := MakeSlice[[]uint64](d, nil, math.MaxInt32)
+	require.NoError(t, err)
+	assert.Empty(t, s)
+	assert.Equal(t, maxPreallocBytes/8, cap(s))
+
+	// elements of size 0 count against MaxBytes
+	_, err = MakeSlice[[]struct{}](d, nil, 101)
+	assert.ErrorIs(t, err, ErrLimitExceeded)
+
+	decodeEmpty := func(*Decoder, *struct{}) error { return nil }
+	m, err := DecodeMap(NewDecoder([]byte{0, 0, 0, 3}), LenUint32, decodeEmpty, decodeEmpty)
+	require.NoError(t, err)
+	assert.Len(t, m, 1)
+
+	d = NewDecoder([]byte{0x7f, 0xff, 0xff, 0xff})
+	d.SetOptions(DecoderOptions{MaxBytes: 100})
+	_, err = DecodeMap(d, LenUint32, decodeEmpty, decodeEmpty)
+	assert.ErrorIs(t, err, ErrLimitExceeded)
+}
@@ -0,0 +1,46 @@
+package mtgpack
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Marshal returns the encoding of v, as encoded by EncodeValue with the default options.
+func Marshal(v interface{}) ([]byte, error) {
+	e := NewEncoder()
+	if err := EncodeValue(e, v); err != nil {
+		return nil, err
+	}
+
+	return e.Bytes(), nil
+}
+
+// Unmarshal decodes a value of type T from b, which must hold exactly one value.
+// It returns ErrTrailingBytes if any input is left after the value. If T is a
+// pointer type, a new value is allocated to decode into.
+func Unmarshal[T any](b []byte) (T, error) {
+	var v T
+	target := interface{}(&v)
+	if typ := reflect.TypeOf(target).Elem(); typ.Kind() == reflect.Pointer {
+		ptr := reflect.New(typ.Elem())
+		reflect.ValueOf(&v).Elem().Set(ptr)
+		target = ptr.Interface()
+	}
+
+	if err := UnmarshalInto(b, target); err != nil {
+		var zero T
+		return zero, err
+	}
+
+	return v, nil
+}
+
+// UnmarshalInto decodes b into the value pointed to by v, which must hold exactly
+// one value. It returns ErrTrailingBytes if any input is left after the value.
+func UnmarshalInto(b []byte, v interface{}) error {
+	if val := reflect.ValueOf(v); val.Kind() != reflect.Pointer || val.IsNil() {
+		return fmt.Errorf("%w: UnmarshalInto requires a non-nil pointer, got %T", ErrUnsupportedType, v)
+	}
+
+	return DecodeAll(NewDecoder(b), v)
+}
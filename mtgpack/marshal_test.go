@@ -0,0 +1,54 @@
+package mtgpack
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarshal(t *testing.T) {
+	type order struct {
+		ID    uuid.UUID
+		Route string
+		Min   decimal.Decimal
+		Legs  []uint16 `mtg:",len=uint16"`
+	}
+
+	v := order{
+		ID:    uuid.New(),
+		Route: "xvgf",
+		Min:   decimal.New(10000000, -8),
+		Legs:  []uint16{1, 2},
+	}
+
+	b, err := Marshal(v)
+	require.NoError(t, err)
+
+	enc := NewEncoder()
+	require.NoError(t, enc.EncodeValue(v))
+	assert.Equal(t, enc.Bytes(), b)
+
+	got, err := Unmarshal[order](b)
+	require.NoError(t, err)
+	assert.Equal(t, v, got)
+
+	ptr, err := Unmarshal[*order](b)
+	require.NoError(t, err)
+	assert.Equal(t, v, *ptr)
+
+	var into order
+	require.NoError(t, UnmarshalInto(b, &into))
+	assert.Equal(t, v, into)
+
+	_, err = Unmarshal[order](append(b, 0))
+	assert.ErrorIs(t, err, ErrTrailingBytes)
+
+	_, err = Unmarshal[order](b[:len(b)-1])
+	assert.ErrorIs(t, err, ErrUnexpectedEOF)
+
+	assert.ErrorIs(t, UnmarshalInto(b, into), ErrUnsupportedType)
+	assert.ErrorIs(t, UnmarshalInto(b, (*order)(nil)), ErrUnsupportedType)
+}
@@ -1,6 +1,8 @@
 package mtgpack
 
 import (
+	"encoding"
+	"math/big"
 	"reflect"
 	"time"
 
@@ -40,4 +42,31 @@ var (
 
 	// timeType is a reflection type for time.Time
 	timeType = reflect.TypeOf(time.Time{})
+
+	// bigIntType is a reflection type for big.Int
+	bigIntType = reflect.TypeOf(big.Int{})
+
+	// reflection types for the interfaces of the encoding package
+	binaryMarshalerType   = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+	binaryUnmarshalerType = reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()
+	textMarshalerType     = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType   = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
 )
+
+// implements reports whether values of type t, or pointers to them, implement
+// the interface type i.
+func implements(t, i reflect.Type) bool {
+	return t.Implements(i) || (t.Kind() != reflect.Pointer && reflect.PointerTo(t).Implements(i))
+}
+
+// isNativeType reports whether values of type t have an encoding of their own,
+// which takes precedence over their MarshalBinary method: times, decimals,
+// big integers and byte arrays such as uuid.UUID.
+func isNativeType(t reflect.Type) bool {
+	switch t {
+	case timeType, decimalType, bigIntType:
+		return true
+	}
+
+	return t.Kind() == reflect.Array && t.Elem().Kind() == reflect.Uint8
+}
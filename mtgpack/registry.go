@@ -0,0 +1,185 @@
+package mtgpack
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// EncodeFunc encodes val, a value of the type it is registered for with
+// RegisterType. val may not be addressable.
+type EncodeFunc func(e *Encoder, val reflect.Value) error
+
+// DecodeFunc decodes into val, an addressable value of the type it is
+// registered for with RegisterType.
+type DecodeFunc func(d *Decoder, val reflect.Value) error
+
+// registeredType holds the functions of a type registered with RegisterType.
+type registeredType struct {
+	encode encoderFunc
+	decode decoderFunc
+	skip   skipperFunc // nil to decode and discard the value
+}
+
+// Registry holds the encodings of the types registered with RegisterType, and
+// the encoders and decoders compiled with them. Encoders and Decoders use the
+// default Registry, which RegisterType adds to, unless given another one with
+// SetRegistry.
+type Registry struct {
+	mu    sync.RWMutex
+	types map[reflect.Type]registeredType
+
+	encoders sync.Map // map[reflect.Type]encoderFunc
+	decoders sync.Map // map[reflect.Type]decoderFunc
+	skippers sync.Map // map[reflect.Type]skipperFunc
+}
+
+// defaultRegistry is the Registry of RegisterType, with the built-in types.
+var defaultRegistry = newBuiltinRegistry()
+
+// newBuiltinRegistry returns a Registry with the types encoded by the package
+// itself. Their encodings may be changed by tags, see fieldTag.
+func newBuiltinRegistry() *Registry {
+	r := &Registry{types: map[reflect.Type]registeredType{}}
+	r.types[decimalType] = registeredType{encodeDecimalValue, decodeDecimalValue, skipDecimal}
+	r.types[timeType] = registeredType{encodeTimeValue, decodeTimeValue, newFixedSkipper(8)}
+	r.types[bigIntType] = registeredType{encodeBigIntValue, decodeBigIntValue, skipBigInt}
+	return r
+}
+
+// NewRegistry returns a Registry with the types currently registered in the
+// default one. Types registered in it do not affect other Encoders and Decoders,
+// for example in tests.
+func NewRegistry() *Registry {
+	defaultRegistry.mu.RLock()
+	defer defaultRegistry.mu.RUnlock()
+
+	r := &Registry{types: make(map[reflect.Type]registeredType, len(defaultRegistry.types))}
+	for t, f := range defaultRegistry.types {
+		r.types[t] = f
+	}
+
+	return r
+}
+
+// RegisterType registers the functions encoding and decoding values of type t
+// in the default Registry, for example:
+//
+//	mtgpack.RegisterType(reflect.TypeOf(netip.Addr{}),
+//		func(e *mtgpack.Encoder, val reflect.Value) error {
+//			return e.EncodeBytes(val.Interface().(netip.Addr).AsSlice())
+//		},
+//		func(d *mtgpack.Decoder, val reflect.Value) error {
+//			b, err := d.DecodeBytes()
+//			if err != nil {
+//				return err
+//			}
+//
+//			addr, _ := netip.AddrFromSlice(b)
+//			val.Set(reflect.ValueOf(addr))
+//			return nil
+//		})
+//
+// Values of type t, even the elements of byte slices and arrays, are then
+// encoded and decoded with them instead of their MarshalBinary method or
+// fields, unless they implement CustomEncoder or a tag selects another encoding,
+// like the text and prec options. Pointers to t are optional values like other
+// pointers. Skipping a value of type t decodes and discards it. Registering t
+// again replaces its functions. decimal.Decimal, time.Time and big.Int are
+// registered already.
+//
+// RegisterType panics if t is nil, a pointer or an interface type, or if a
+// function is nil. It is meant to be called from init functions, before values
+// of type t are encoded or decoded.
+func RegisterType(t reflect.Type, encode EncodeFunc, decode DecodeFunc) {
+	defaultRegistry.RegisterType(t, encode, decode)
+}
+
+// RegisterType registers the functions encoding and decoding values of type t
+// in r, see RegisterType.
+func (r *Registry) RegisterType(t reflect.Type, encode EncodeFunc, decode DecodeFunc) {
+	if t == nil {
+		panic("mtgpack: RegisterType of nil type")
+	}
+
+	if k := t.Kind(); k == reflect.Pointer || k == reflect.Interface {
+		panic(fmt.Sprintf("mtgpack: RegisterType of %s type %s", k, t))
+	}
+
+	if encode == nil || decode == nil {
+		panic(fmt.Sprintf("mtgpack: RegisterType of %s with a nil function", t))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.types[t] = registeredType{encode: encoderFunc(encode), decode: decoderFunc(decode)}
+
+	// the compiled encoders and decoders may refer to the previous functions
+	for _, m := range []*sync.Map{&r.encoders, &r.decoders, &r.skippers} {
+		m.Range(func(key, _ interface{}) bool {
+			m.Delete(key)
+			return true
+		})
+	}
+}
+
+// lookup returns the functions registered for type t.
+func (r *Registry) lookup(t reflect.Type) (registeredType, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	f, ok := r.types[t]
+	return f, ok
+}
+
+// isBytes reports whether slices or arrays of type t are encoded as raw bytes,
+// which their elements are unless they are bytes with an encoding of their own.
+func (r *Registry) isBytes(t reflect.Type) bool {
+	elem := t.Elem()
+	if elem.Kind() != reflect.Uint8 {
+		return false
+	}
+
+	if _, ok := r.lookup(elem); ok {
+		return false
+	}
+
+	for _, i := range []reflect.Type{customEncoderType, customDecoderType, binaryMarshalerType, binaryUnmarshalerType} {
+		if implements(elem, i) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// SetRegistry makes the Encoder encode the types registered in r, or in the
+// default Registry if r is nil.
+func (e *Encoder) SetRegistry(r *Registry) {
+	e.types = r
+}
+
+// registry returns the Registry of the Encoder.
+func (e *Encoder) registry() *Registry {
+	if e.types == nil {
+		return defaultRegistry
+	}
+
+	return e.types
+}
+
+// SetRegistry makes the Decoder decode the types registered in r, or in the
+// default Registry if r is nil.
+func (d *Decoder) SetRegistry(r *Registry) {
+	d.types = r
+}
+
+// registry returns the Registry of the Decoder.
+func (d *Decoder) registry() *Registry {
+	if d.types == nil {
+		return defaultRegistry
+	}
+
+	return d.types
+}
@@ -0,0 +1,289 @@
+package mtgpack
+
+import (
+	"errors"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var addrType = reflect.TypeOf(netip.Addr{})
+
+// encodeAddr encodes an address as its bit length, followed by its bytes.
+func encodeAddr(e *Encoder, val reflect.Value) error {
+	addr := val.Interface().(netip.Addr)
+	if err := e.EncodeUint8(uint8(addr.BitLen())); err != nil {
+		return err
+	}
+
+	_, err := e.Write(addr.AsSlice())
+	return err
+}
+
+func decodeAddr(d *Decoder, val reflect.Value) error {
+	n, err := d.DecodeUint8()
+	if err != nil {
+		return err
+	}
+
+	b, err := d.ReadN(int(n) / 8)
+	if err != nil {
+		return err
+	}
+
+	addr, ok := netip.AddrFromSlice(b)
+	if !ok && n != 0 {
+		return errors.New("invalid address length")
+	}
+
+	val.Set(reflect.ValueOf(addr))
+	return nil
+}
+
+// testLevel is a byte registered with encodeLevel.
+type testLevel uint8
+
+func encodeLevel(e *Encoder, val reflect.Value) error {
+	return e.EncodeUint16(uint16(val.Uint()) + 1000)
+}
+
+func decodeLevel(d *Decoder, val reflect.Value) error {
+	x, err := d.DecodeUint16()
+	val.SetUint(uint64(x - 1000))
+	return err
+}
+
+// testLevelKey encodes a testLevel with the Registry of the Encoder.
+type testLevelKey uint8
+
+func (k testLevelKey) EncodeMtg(e *Encoder) error {
+	return e.EncodeValue(testLevel(k))
+}
+
+func (k *testLevelKey) DecodeMtg(d *Decoder) error {
+	var x testLevel
+	err := d.DecodeValue(&x)
+	*k = testLevelKey(x)
+	return err
+}
+
+// testCelsius is registered in the default Registry.
+type testCelsius float64
+
+func init() {
+	RegisterType(reflect.TypeOf(testCelsius(0)),
+		func(e *Encoder, val reflect.Value) error {
+			return e.EncodeInt16(int16(val.Float() * 10))
+		},
+		func(d *Decoder, val reflect.Value) error {
+			x, err := d.DecodeInt16()
+			val.SetFloat(float64(x) / 10)
+			return err
+		})
+}
+
+func TestRegisterType(t *testing.T) {
+	type peer struct {
+		Addr     netip.Addr
+		Fallback *netip.Addr
+		Routes   []netip.Addr
+	}
+
+	fallback := netip.MustParseAddr("::1")
+	x := peer{
+		Addr:     netip.MustParseAddr("10.0.0.1"),
+		Fallback: &fallback,
+		Routes:   []netip.Addr{netip.MustParseAddr("10.0.0.2")},
+	}
+
+	r := NewRegistry()
+	r.RegisterType(addrType, encodeAddr, decodeAddr)
+
+	enc := NewEncoder()
+	enc.SetRegistry(r)
+	require.NoError(t, enc.EncodeValue(x))
+
+	want := []byte{32, 10, 0, 0, 1, 1, 128}
+	want = append(want, fallback.AsSlice()...)
+	want = append(want, 1, 32, 10, 0, 0, 2)
+	assert.Equal(t, want, enc.Bytes())
+
+	dec := NewDecoder(enc.Bytes())
+	dec.SetRegistry(r)
+	var y peer
+	require.NoError(t, dec.DecodeValue(&y))
+	assert.Zero(t, dec.Remaining())
+	assert.Equal(t, x, y)
+
+	dec = NewDecoder(enc.Bytes())
+	dec.SetRegistry(r)
+	require.NoError(t, dec.SkipValue(reflect.TypeOf(x)))
+	assert.Zero(t, dec.Remaining())
+
+	t.Run("isolation", func(t *testing.T) {
+		// the default Registry encodes netip.Addr with its MarshalBinary method
+		b, err := Marshal(x.Addr)
+		require.NoError(t, err)
+		assert.Equal(t, []byte{4, 10, 0, 0, 1}, b)
+
+		b, err = Marshal(x)
+		require.NoError(t, err)
+		assert.NotEqual(t, enc.Bytes(), b)
+
+		y, err := Unmarshal[peer](b)
+		require.NoError(t, err)
+		assert.Equal(t, x, y)
+	})
+
+	t.Run("top level", func(t *testing.T) {
+		enc := NewEncoder()
+		enc.SetRegistry(r)
+		require.NoError(t, enc.EncodeValue(fallback))
+		assert.Equal(t, append([]byte{128}, fallback.AsSlice()...), enc.Bytes())
+	})
+
+	t.Run("default registry", func(t *testing.T) {
+		type reading struct {
+			Temperature testCelsius
+			Samples     []testCelsius
+		}
+
+		x := reading{Temperature: 21.5, Samples: []testCelsius{-3.2}}
+		b, err := Marshal(x)
+		require.NoError(t, err)
+		assert.Equal(t, []byte{0, 215, 1, 0xff, 0xe0}, b)
+
+		y, err := Unmarshal[reading](b)
+		require.NoError(t, err)
+		assert.Equal(t, x, y)
+
+		// registries created afterwards have the type too
+		dec := NewDecoder(b)
+		dec.SetRegistry(NewRegistry())
+		require.NoError(t, dec.SkipValue(reflect.TypeOf(x)))
+		assert.Zero(t, dec.Remaining())
+	})
+
+	t.Run("built-in override", func(t *testing.T) {
+		type event struct {
+			At       time.Time
+			Deadline time.Time `mtg:",unix"`
+		}
+
+		r := NewRegistry()
+		r.RegisterType(timeType,
+			func(e *Encoder, val reflect.Value) error {
+				return e.EncodeUint32(uint32(timeValue(val).Unix()))
+			},
+			func(d *Decoder, val reflect.Value) error {
+				x, err := d.DecodeUint32()
+				val.Set(reflect.ValueOf(time.Unix(int64(x), 0).UTC()))
+				return err
+			})
+
+		x := event{At: time.Unix(1700000000, 0).UTC(), Deadline: time.Unix(1700000001, 0)}
+		enc := NewEncoder()
+		enc.SetRegistry(r)
+		require.NoError(t, enc.EncodeValue(x))
+
+		// tags select the built-in encodings
+		want := AppendUint32(nil, 1700000000)
+		want = AppendInt64(want, 1700000001)
+		assert.Equal(t, want, enc.Bytes())
+
+		dec := NewDecoder(enc.Bytes())
+		dec.SetRegistry(r)
+		var y event
+		require.NoError(t, dec.DecodeValue(&y))
+		assert.Equal(t, x.At, y.At)
+		assert.True(t, x.Deadline.Equal(y.Deadline))
+
+		b, err := Marshal(x)
+		require.NoError(t, err)
+		assert.Len(t, b, 16)
+	})
+
+	t.Run("bytes", func(t *testing.T) {
+		type levels struct {
+			Level testLevel
+			Slice []testLevel
+			Array [2]testLevel
+			Keys  map[testLevelKey]uint8
+			Plain []byte
+			Fixed [2]byte
+		}
+
+		r := NewRegistry()
+		r.RegisterType(reflect.TypeOf(testLevel(0)), encodeLevel, decodeLevel)
+
+		x := levels{
+			Level: 1,
+			Slice: []testLevel{1, 2},
+			Array: [2]testLevel{1, 2},
+			Keys:  map[testLevelKey]uint8{2: 7, 1: 8},
+			Plain: []byte{1, 2},
+			Fixed: [2]byte{1, 2},
+		}
+
+		enc := NewEncoder()
+		enc.SetRegistry(r)
+		require.NoError(t, enc.EncodeValue(x))
+
+		// elements of registered byte types are encoded with their functions
+		want := []byte{0x03, 0xe9}
+		want = append(want, 2, 0x03, 0xe9, 0x03, 0xea)
+		want = append(want, 0x03, 0xe9, 0x03, 0xea)
+		want = append(want, 2, 0x03, 0xe9, 8, 0x03, 0xea, 7)
+		want = append(want, 2, 1, 2, 1, 2)
+		assert.Equal(t, want, enc.Bytes())
+
+		dec := NewDecoder(enc.Bytes())
+		dec.SetRegistry(r)
+		dec.SetOptions(DecoderOptions{Strict: true})
+		var y levels
+		require.NoError(t, dec.DecodeValue(&y))
+		assert.Zero(t, dec.Remaining())
+		assert.Equal(t, x, y)
+
+		dec = NewDecoder(enc.Bytes())
+		dec.SetRegistry(r)
+		require.NoError(t, dec.SkipValue(reflect.TypeOf(x)))
+		assert.Zero(t, dec.Remaining())
+
+		enc = NewEncoder()
+		enc.SetRegistry(r)
+		encodeKey := func(e *Encoder, k testLevelKey) error { return k.EncodeMtg(e) }
+		require.NoError(t, EncodeMap(enc, x.Keys, 0, encodeKey, (*Encoder).EncodeUint8))
+		assert.Equal(t, want[11:18], enc.Bytes())
+	})
+
+	t.Run("replace", func(t *testing.T) {
+		r := NewRegistry()
+		r.RegisterType(addrType, encodeAddr, decodeAddr)
+
+		enc := NewEncoder()
+		enc.SetRegistry(r)
+		require.NoError(t, enc.EncodeValue(x))
+
+		// the encoders compiled with the previous functions are discarded
+		r.RegisterType(addrType, func(e *Encoder, val reflect.Value) error {
+			return e.EncodeString(val.Interface().(netip.Addr).String())
+		}, decodeAddr)
+
+		enc.Reset()
+		require.NoError(t, enc.EncodeValue(x))
+		assert.Equal(t, append([]byte{8}, "10.0.0.1"...), enc.Bytes()[:9])
+	})
+
+	t.Run("panics", func(t *testing.T) {
+		r := NewRegistry()
+		assert.Panics(t, func() { r.RegisterType(nil, encodeAddr, decodeAddr) })
+		assert.Panics(t, func() { r.RegisterType(reflect.PointerTo(addrType), encodeAddr, decodeAddr) })
+		assert.Panics(t, func() { r.RegisterType(reflect.TypeOf((*testAction)(nil)).Elem(), encodeAddr, decodeAddr) })
+		assert.Panics(t, func() { r.RegisterType(addrType, nil, decodeAddr) })
+	})
+}
@@ -0,0 +1,401 @@
+package mtgpack
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// CustomSkipper is implemented by types with a CustomDecoder whose encoded
+// values can be skipped without being decoded. SkipMtg is called on a zero
+// value of the type, so it must not depend on the state of its receiver.
+type CustomSkipper interface {
+	SkipMtg(*Decoder) error
+}
+
+// customSkipperType is a reflection type for the CustomSkipper interface.
+var customSkipperType = reflect.TypeOf((*CustomSkipper)(nil)).Elem()
+
+// SkipValue discards a value of type t, encoded like DecodeValue would decode
+// it, without allocating it. Skipped values are not validated, except for the
+// limits of the DecoderOptions. Values of types with a CustomDecoder that is
+// not a CustomSkipper are decoded and discarded.
+func (d *Decoder) SkipValue(t reflect.Type) error {
+	offset := d.off
+	if t == nil {
+		return d.wrapError(offset, fmt.Errorf("%w: nil type", ErrUnsupportedType))
+	}
+
+	return d.wrapError(offset, d.registry().typeSkipper(t)(d))
+}
+
+// skipperFunc discards a value of the type the function was compiled for.
+type skipperFunc func(d *Decoder) error
+
+// typeSkipper returns the cached skipper of values of type t, compiling it on
+// first use.
+func (r *Registry) typeSkipper(t reflect.Type) skipperFunc {
+	if f, ok := r.skippers.Load(t); ok {
+		return f.(skipperFunc)
+	}
+
+	// see typeEncoder for recursive types
+	var (
+		wg sync.WaitGroup
+		f  skipperFunc
+	)
+
+	wg.Add(1)
+	fi, loaded := r.skippers.LoadOrStore(t, skipperFunc(func(d *Decoder) error {
+		wg.Wait()
+		return f(d)
+	}))
+	if loaded {
+		return fi.(skipperFunc)
+	}
+
+	f = r.newTypeSkipper(t)
+	wg.Done()
+	r.skippers.Store(t, f)
+	return f
+}
+
+func (r *Registry) newTypeSkipper(t reflect.Type) skipperFunc {
+	if t.Kind() != reflect.Pointer || isCustomDecoder(t) {
+		return r.newElemSkipper(t, fieldTag{})
+	}
+
+	return r.typeSkipper(t.Elem())
+}
+
+// isCustomDecoder reports whether values of type t are decoded by a CustomDecoder.
+func isCustomDecoder(t reflect.Type) bool {
+	return reflect.PointerTo(t).Implements(customDecoderType)
+}
+
+// skipChild skips a value nested in a struct, slice or map with skip,
+// recording the given path element for errors.
+func skipChild(d *Decoder, skip skipperFunc, elem pathElem) error {
+	offset := d.off
+	d.pushPath(elem)
+	defer d.popPath()
+
+	if err := d.checkDepth(offset); err != nil {
+		return err
+	}
+
+	return d.wrapError(offset, skip(d))
+}
+
+// newValueSkipper returns the skipper of values of type t nested in a struct,
+// slice or map, like newValueDecoder.
+func (r *Registry) newValueSkipper(t reflect.Type, tag fieldTag) skipperFunc {
+	var skip skipperFunc
+	switch {
+	case t.Kind() == reflect.Pointer && t.Implements(customDecoderType):
+		skip = newCustomSkipper(t.Elem())
+	case t.Kind() == reflect.Pointer:
+		skip = r.elemSkipper(t.Elem(), tag)
+	case tag.optional:
+		skip = r.elemSkipper(t, tag)
+	default:
+		return r.elemSkipper(t, tag)
+	}
+
+	return func(d *Decoder) error {
+		present, err := d.DecodeBool()
+		if err != nil || !present {
+			return err
+		}
+
+		return skip(d)
+	}
+}
+
+// elemSkipper returns the skipper of values of type t with the given tag, the
+// cached one if the tag does not change how the value itself is encoded.
+func (r *Registry) elemSkipper(t reflect.Type, tag fieldTag) skipperFunc {
+	if !tag.changesElem() {
+		return r.typeSkipper(t)
+	}
+
+	return r.newElemSkipper(t, tag)
+}
+
+func (r *Registry) newElemSkipper(t reflect.Type, tag fieldTag) skipperFunc {
+	if isCustomDecoder(t) {
+		return newCustomSkipper(t)
+	}
+
+	if tag.text {
+		return newStringSkipper(tag.len)
+	}
+
+	if t == timeType && tag.changesElem() {
+		if tag.typ == nil {
+			return newIntSkipper(8, tag.varint)
+		}
+
+		return newIntSkipper(int(tag.typ.Size()), tag.varint)
+	}
+
+	if tag.typ != nil {
+		return newIntSkipper(int(tag.typ.Size()), tag.varint)
+	}
+
+	if tag.varint {
+		return skipVarint
+	}
+
+	if t == decimalType && tag.hasPrec {
+		return newFixedSkipper(8)
+	}
+
+	if t == decimalType && tag.bigDecimal {
+		return skipBigDecimal
+	}
+
+	if f, ok := r.lookup(t); ok {
+		if f.skip != nil {
+			return f.skip
+		}
+
+		decode := f.decode
+		return func(d *Decoder) error {
+			return decode(d, reflect.New(t).Elem())
+		}
+	}
+
+	if isBinaryType(t) {
+		return newStringSkipper(tag.len)
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Uint:
+		return newFixedSkipper(8)
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.Bool:
+		return newFixedSkipper(int(t.Size()))
+	case reflect.String:
+		return newStringSkipper(tag.len)
+	case reflect.Struct:
+		return r.newStructSkipper(t)
+	case reflect.Slice:
+		return r.newSliceSkipper(t, tag.len)
+	case reflect.Array:
+		return r.newArraySkipper(t)
+	case reflect.Map:
+		return r.newMapSkipper(t, tag.len)
+	case reflect.Interface:
+		return newUnionSkipper(t)
+	}
+
+	err := fmt.Errorf("%w: %s", ErrUnsupportedType, t)
+	return func(d *Decoder) error {
+		return err
+	}
+}
+
+// newCustomSkipper returns the skipper of values of type t, whose pointer
+// implements CustomDecoder. It uses the CustomSkipper of the type if it has
+// one, or decodes and discards the values.
+func newCustomSkipper(t reflect.Type) skipperFunc {
+	if s, ok := reflect.New(t).Interface().(CustomSkipper); ok {
+		return s.SkipMtg
+	}
+
+	return func(d *Decoder) error {
+		return decodeCustom(d, reflect.New(t))
+	}
+}
+
+// newFixedSkipper returns the skipper of values encoded in size bytes.
+func newFixedSkipper(size int) skipperFunc {
+	return func(d *Decoder) error {
+		return d.Skip(size)
+	}
+}
+
+// newStringSkipper returns the skipper of strings and byte slices, with the
+// length prefix p.
+func newStringSkipper(p LenPrefix) skipperFunc {
+	return func(d *Decoder) error {
+		return d.SkipStringLen(p)
+	}
+}
+
+// newIntSkipper returns the skipper of integers encoded in size bytes, or as
+// varints.
+func newIntSkipper(size int, varint bool) skipperFunc {
+	if varint {
+		return skipVarint
+	}
+
+	return newFixedSkipper(size)
+}
+
+func skipVarint(d *Decoder) error {
+	_, err := d.DecodeUvarint()
+	return err
+}
+
+func skipBigInt(d *Decoder) error {
+	if err := d.Skip(1); err != nil {
+		return err
+	}
+
+	return d.SkipString()
+}
+
+// skipDecimal skips a decimal encoded with the options of the Decoder.
+func skipDecimal(d *Decoder) error {
+	if d.opts.BigDecimal {
+		return skipBigDecimal(d)
+	}
+
+	return d.Skip(8)
+}
+
+func skipBigDecimal(d *Decoder) error {
+	if err := skipBigInt(d); err != nil {
+		return err
+	}
+
+	return skipVarint(d)
+}
+
+// newSliceSkipper returns the skipper of length prefixed slices.
+func (r *Registry) newSliceSkipper(t reflect.Type, p LenPrefix) skipperFunc {
+	if r.isBytes(t) {
+		return func(d *Decoder) error {
+			return d.SkipStringLen(p)
+		}
+	}
+
+	elem := r.newValueSkipper(t.Elem(), fieldTag{})
+	size := t.Elem().Size()
+	return func(d *Decoder) error {
+		n, err := d.DecodeLen(p)
+		if err != nil {
+			return err
+		}
+
+		if err := d.checkZeroSize(n, size); err != nil {
+			return err
+		}
+
+		for i := 0; i < n; i++ {
+			if err := skipChild(d, elem, pathElem{index: i}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+func (r *Registry) newArraySkipper(t reflect.Type) skipperFunc {
+	if r.isBytes(t) {
+		return newFixedSkipper(t.Len())
+	}
+
+	n := t.Len()
+	elem := r.newValueSkipper(t.Elem(), fieldTag{})
+	return func(d *Decoder) error {
+		for i := 0; i < n; i++ {
+			if err := skipChild(d, elem, pathElem{index: i}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+// newMapSkipper returns the skipper of length prefixed maps. Map entries are
+// recorded in error paths by their index, as their keys are not decoded.
+func (r *Registry) newMapSkipper(t reflect.Type, p LenPrefix) skipperFunc {
+	key := r.newValueSkipper(t.Key(), fieldTag{})
+	value := r.newValueSkipper(t.Elem(), fieldTag{})
+	size := t.Key().Size() + t.Elem().Size()
+	return func(d *Decoder) error {
+		n, err := d.DecodeLen(p)
+		if err != nil {
+			return err
+		}
+
+		if err := d.checkZeroSize(n, size); err != nil {
+			return err
+		}
+
+		for i := 0; i < n; i++ {
+			if err := skipChild(d, key, pathElem{index: i}); err != nil {
+				return err
+			}
+
+			if err := skipChild(d, value, pathElem{index: i}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+// fieldSkipper skips a field of a struct.
+type fieldSkipper struct {
+	name string
+	skip skipperFunc
+}
+
+// newStructSkipper returns the skipper of the fields of a struct in declaration order.
+func (r *Registry) newStructSkipper(t reflect.Type) skipperFunc {
+	fields, err := typeFields(t)
+	if err != nil {
+		return func(d *Decoder) error {
+			return err
+		}
+	}
+
+	skippers := make([]fieldSkipper, 0, len(fields))
+	for _, f := range fields {
+		skippers = append(skippers, fieldSkipper{
+			name: f.name,
+			skip: r.newValueSkipper(t.Field(f.index).Type, f.tag),
+		})
+	}
+
+	return func(d *Decoder) error {
+		for _, f := range skippers {
+			if err := skipChild(d, f.skip, pathElem{field: f.name}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+// newUnionSkipper returns the skipper of values of the interface type t, a
+// discriminator followed by a value of its variant type.
+func newUnionSkipper(t reflect.Type) skipperFunc {
+	return func(d *Decoder) error {
+		u, err := lookupUnion(t)
+		if err != nil {
+			return err
+		}
+
+		tag, err := d.DecodeUint8()
+		if err != nil {
+			return err
+		}
+
+		vt, ok := u.types[tag]
+		if !ok {
+			return fmt.Errorf("%w: %d of %s", ErrUnknownVariant, tag, t)
+		}
+
+		return d.registry().typeSkipper(vt)(d)
+	}
+}
@@ -0,0 +1,202 @@
+package mtgpack
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testSkipped struct {
+	Order    testOrder
+	Flag     bool
+	Rate     float32
+	Size     int
+	Nonce    uint64 `mtg:",varint"`
+	Offset   int32  `mtg:"int8"`
+	Name     string `mtg:",optional"`
+	Extra    []byte `mtg:",len=uint16"`
+	Hash     [4]byte
+	Quotes   [2]uint16
+	Legs     []*testHeader
+	Weights  map[string]decimal.Decimal
+	Fee      decimal.Decimal `mtg:",prec=2"`
+	Volume   decimal.Decimal `mtg:",big"`
+	Supply   *big.Int
+	Deadline time.Time
+	Expiry   time.Time `mtg:"uint32,unix"`
+	Created  time.Time `mtg:",varint"`
+	Node     testNode
+	Action   testAction
+	Next     testAction `mtg:",optional"`
+}
+
+func TestSkipValue(t *testing.T) {
+	x := testSkipped{
+		Order: testOrder{
+			Header: testHeader{Version: 1, Action: 3},
+			Asset:  uuid.New(),
+			Amount: decimal.NewFromFloat(1.5),
+			Route:  "xvgf",
+			Count:  2,
+		},
+		Flag:     true,
+		Rate:     0.5,
+		Size:     -7,
+		Nonce:    1 << 40,
+		Offset:   -3,
+		Name:     "name",
+		Extra:    []byte{1, 2, 3},
+		Hash:     [4]byte{1, 2, 3, 4},
+		Quotes:   [2]uint16{5, 6},
+		Legs:     []*testHeader{{Version: 1}, nil},
+		Weights:  map[string]decimal.Decimal{"a": decimal.NewFromInt(1), "b": decimal.NewFromInt(2)},
+		Fee:      decimal.NewFromFloat(0.25),
+		Volume:   decimal.RequireFromString("123456789012345678901234567890.5"),
+		Supply:   new(big.Int).Lsh(big.NewInt(1), 100),
+		Deadline: time.Unix(1700000000, 0),
+		Expiry:   time.Unix(1700000000, 0),
+		Created:  time.Unix(1700000000, 0),
+		Node:     testNode{Value: 1, Next: &testNode{}, Children: []testNode{{Value: 2}}},
+		Action:   &testSwap{Asset: uuid.New(), Route: "route"},
+	}
+
+	for _, opts := range []EncoderOptions{
+		{},
+		{LenPrefix: LenUvarint},
+		{BigDecimal: true},
+	} {
+		enc := NewEncoder()
+		enc.SetOptions(opts)
+		require.NoError(t, enc.EncodeValues(&x, uint8(0xff)))
+		b := enc.Bytes()
+
+		decoderOpts := DecoderOptions{LenPrefix: opts.LenPrefix, BigDecimal: opts.BigDecimal}
+		for _, dec := range []*Decoder{
+			NewDecoder(b),
+			{Reader: bytes.NewReader(b)},
+		} {
+			dec.SetOptions(decoderOpts)
+			require.NoError(t, dec.SkipValue(reflect.TypeOf(x)))
+			assert.Equal(t, int64(len(b)-1), dec.Offset())
+
+			last, err := dec.DecodeUint8()
+			require.NoError(t, err)
+			assert.EqualValues(t, 0xff, last)
+		}
+	}
+
+	t.Run("pointer", func(t *testing.T) {
+		b, err := Marshal(&x.Order)
+		require.NoError(t, err)
+
+		dec := NewDecoder(b)
+		require.NoError(t, dec.SkipValue(reflect.TypeOf(&x.Order)))
+		assert.Zero(t, dec.Remaining())
+	})
+
+	t.Run("zero alloc", func(t *testing.T) {
+		b, err := Marshal(x.Order)
+		require.NoError(t, err)
+
+		typ := reflect.TypeOf(x.Order)
+		dec := NewDecoder(nil)
+		allocs := testing.AllocsPerRun(10, func() {
+			dec.Reset(b)
+			if err := dec.SkipValue(typ); err != nil {
+				t.Fatal(err)
+			}
+		})
+
+		assert.Zero(t, allocs)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		b, err := Marshal(x)
+		require.NoError(t, err)
+
+		for i := range b {
+			err := NewDecoder(b[:i]).SkipValue(reflect.TypeOf(x))
+			assert.ErrorIs(t, err, ErrUnexpectedEOF, "truncated at %d", i)
+		}
+
+		err = NewDecoder(b[:len(x.Order.Route)]).SkipValue(reflect.TypeOf(x))
+		var de *DecodeError
+		require.True(t, errors.As(err, &de))
+		assert.Equal(t, "Order.Asset", de.Path)
+
+		err = NewDecoder(b).SkipValue(reflect.TypeOf(func() {}))
+		assert.ErrorIs(t, err, ErrUnsupportedType)
+
+		dec := NewDecoder(b)
+		dec.SetOptions(DecoderOptions{MaxDepth: 2})
+		assert.ErrorIs(t, dec.SkipValue(reflect.TypeOf(x)), ErrLimitExceeded)
+	})
+}
+
+func TestPeekSkip(t *testing.T) {
+	enc := NewEncoder()
+	require.NoError(t, enc.EncodeValues(uint16(3), "hello", []byte("world"), uint8(7)))
+	b := enc.Bytes()
+
+	for name, dec := range map[string]*Decoder{
+		"bytes":  NewDecoder(b),
+		"reader": {Reader: bufio.NewReader(bytes.NewReader(b))},
+	} {
+		t.Run(name, func(t *testing.T) {
+			p, err := dec.Peek(2)
+			require.NoError(t, err)
+			assert.Equal(t, []byte{0, 3}, p)
+			assert.Zero(t, dec.Offset())
+
+			require.NoError(t, dec.Skip(2))
+			require.NoError(t, dec.SkipString())
+			require.NoError(t, dec.SkipString())
+
+			_, err = dec.Peek(2)
+			assert.ErrorIs(t, err, ErrUnexpectedEOF)
+
+			x, err := dec.DecodeUint8()
+			require.NoError(t, err)
+			assert.EqualValues(t, 7, x)
+
+			assert.ErrorIs(t, dec.Skip(1), ErrUnexpectedEOF)
+		})
+	}
+
+	t.Run("unbuffered reader", func(t *testing.T) {
+		dec := &Decoder{Reader: bytes.NewReader(b)}
+		_, err := dec.Peek(1)
+		assert.ErrorIs(t, err, ErrUnsupportedType)
+
+		require.NoError(t, dec.Skip(2))
+		s, err := dec.DecodeString()
+		require.NoError(t, err)
+		assert.Equal(t, "hello", s)
+	})
+
+	t.Run("negative", func(t *testing.T) {
+		for _, dec := range []*Decoder{NewDecoder(b), {Reader: bufio.NewReader(bytes.NewReader(b))}} {
+			require.NoError(t, dec.Skip(2))
+
+			_, err := dec.Peek(-1)
+			assert.Error(t, err)
+			assert.Error(t, dec.Skip(-1))
+			_, err = dec.ReadN(-1)
+			assert.Error(t, err)
+			assert.EqualValues(t, 2, dec.Offset())
+
+			s, err := dec.DecodeString()
+			require.NoError(t, err)
+			assert.Equal(t, "hello", s)
+		}
+	})
+}
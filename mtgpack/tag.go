@@ -0,0 +1,312 @@
+package mtgpack
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// fieldTag holds the encoding options parsed from the `mtg` tag of a struct field.
+//
+// The tag has the form `mtg:"type,option,..."`. The optional type overrides the
+// wire type of an integer field, for example `mtg:"uint8"` encodes an int field
+// as a single byte. The tag `mtg:"-"` skips the field.
+//
+// Supported options:
+//
+//	len=PREFIX  the length prefix of a string, slice or map: uint8, uint16, uint32 or uvarint
+//	optional    prefix the field with a bool reporting whether it is present, zero
+//	            values are omitted. Pointer fields are always optional.
+//	varint      encode an integer as a varint, zigzag encoded if it is signed
+//	prec=N      the number of fractional digits of a decimal, between 0 and 18
+//	big         encode a decimal without loss of precision, see Encoder.EncodeBigDecimal
+//	unix        encode a time as Unix seconds, unixmilli and unixnano select
+//	            milliseconds and nanoseconds. The type and varint also apply to times.
+//	utc         decode a time in UTC instead of the local time
+//	text        encode a value with its MarshalText and UnmarshalText methods, as
+//	            a length prefixed string
+//
+// Values of types with MarshalBinary and UnmarshalBinary methods are encoded as
+// length prefixed byte slices with them, unless the type is a CustomEncoder or
+// has an encoding of its own, like time.Time and uuid.UUID.
+type fieldTag struct {
+	skip       bool
+	typ        reflect.Type // wire type override, nil if not set
+	len        LenPrefix
+	optional   bool
+	varint     bool
+	hasPrec    bool  // whether prec is set
+	prec       int32 // decimal precision
+	bigDecimal bool
+	timeUnit   TimeUnit
+	utc        bool
+	text       bool
+}
+
+// timeUnits maps the time options to time units.
+var timeUnits = map[string]TimeUnit{
+	"unixnano":  TimeUnixNano,
+	"unixmilli": TimeUnixMilli,
+	"unix":      TimeUnix,
+}
+
+// overrideTypes maps the type names accepted in `mtg` tags to their wire types.
+var overrideTypes = map[string]reflect.Type{
+	"int8":   reflect.TypeOf(int8(0)),
+	"int16":  reflect.TypeOf(int16(0)),
+	"int32":  reflect.TypeOf(int32(0)),
+	"int64":  reflect.TypeOf(int64(0)),
+	"uint8":  reflect.TypeOf(uint8(0)),
+	"uint16": reflect.TypeOf(uint16(0)),
+	"uint32": reflect.TypeOf(uint32(0)),
+	"uint64": reflect.TypeOf(uint64(0)),
+}
+
+// lenPrefixes maps the names accepted by the len option to length prefix types.
+var lenPrefixes = map[string]LenPrefix{
+	"uint8":   LenUint8,
+	"uint16":  LenUint16,
+	"uint32":  LenUint32,
+	"uvarint": LenUvarint,
+}
+
+// parseTag parses the `mtg` tag of a field with the given type.
+func parseTag(tag string, typ reflect.Type) (fieldTag, error) {
+	var ft fieldTag
+	if tag == "-" {
+		ft.skip = true
+		return ft, nil
+	}
+
+	name, opts, _ := strings.Cut(tag, ",")
+	if name != "" {
+		t, ok := overrideTypes[name]
+		if !ok {
+			return ft, fmt.Errorf("unknown type %q", name)
+		}
+
+		if !isIntKind(indirect(typ).Kind()) && indirect(typ) != timeType {
+			return ft, fmt.Errorf("type %q cannot be applied to %s", name, typ)
+		}
+
+		ft.typ = t
+	}
+
+	if opts == "" {
+		return ft, nil
+	}
+
+	for _, opt := range strings.Split(opts, ",") {
+		key, value, _ := strings.Cut(opt, "=")
+		switch key {
+		case "len":
+			p, ok := lenPrefixes[value]
+			if !ok {
+				return ft, fmt.Errorf("unknown length prefix %q", value)
+			}
+
+			ft.len = p
+		case "optional":
+			ft.optional = true
+		case "varint":
+			if !isIntKind(indirect(typ).Kind()) && indirect(typ) != timeType {
+				return ft, fmt.Errorf("option %q cannot be applied to %s", opt, typ)
+			}
+
+			ft.varint = true
+		case "prec":
+			prec, err := strconv.ParseInt(value, 10, 32)
+			if err != nil || prec < 0 || prec > int64(MaxDecimalPrecision) {
+				return ft, fmt.Errorf("invalid decimal precision %q", value)
+			}
+
+			if indirect(typ) != decimalType {
+				return ft, fmt.Errorf("option %q cannot be applied to %s", opt, typ)
+			}
+
+			ft.hasPrec, ft.prec = true, int32(prec)
+		case "big":
+			if indirect(typ) != decimalType {
+				return ft, fmt.Errorf("option %q cannot be applied to %s", opt, typ)
+			}
+
+			ft.bigDecimal = true
+		case "text":
+			if !implements(indirect(typ), textMarshalerType) {
+				return ft, fmt.Errorf("option %q cannot be applied to %s", opt, typ)
+			}
+
+			ft.text = true
+		case "unix", "unixmilli", "unixnano", "utc":
+			if indirect(typ) != timeType {
+				return ft, fmt.Errorf("option %q cannot be applied to %s", opt, typ)
+			}
+
+			if key == "utc" {
+				ft.utc = true
+			} else {
+				ft.timeUnit = timeUnits[key]
+			}
+		default:
+			return ft, fmt.Errorf("unknown option %q", opt)
+		}
+	}
+
+	if ft.hasPrec && ft.bigDecimal {
+		return ft, fmt.Errorf("options %q and %q cannot be combined", "prec", "big")
+	}
+
+	// the length prefix applies to strings, slices, maps and the text or binary
+	// form of a value
+	if ft.len != 0 && !ft.text && !isBinaryType(indirect(typ)) {
+		if k := indirect(typ).Kind(); k != reflect.String && k != reflect.Slice && k != reflect.Map {
+			return ft, fmt.Errorf("option %q cannot be applied to %s", "len", typ)
+		}
+	}
+
+	return ft, nil
+}
+
+// isBinaryType reports whether values of type t are encoded with their
+// MarshalBinary method and decoded with their UnmarshalBinary method. Types
+// with only one of them are encoded like other types, so that both sides agree.
+func isBinaryType(t reflect.Type) bool {
+	if isNativeType(t) || implements(t, customEncoderType) {
+		return false
+	}
+
+	return implements(t, binaryMarshalerType) && implements(t, binaryUnmarshalerType)
+}
+
+// changesElem reports whether the tag changes how the value itself is encoded,
+// besides whether it is optional.
+func (ft fieldTag) changesElem() bool {
+	return ft.typ != nil || ft.len != 0 || ft.varint || ft.hasPrec || ft.bigDecimal ||
+		ft.timeUnit != 0 || ft.utc || ft.text
+}
+
+// structField describes an encoded field of a struct.
+type structField struct {
+	name  string
+	index int
+	tag   fieldTag
+}
+
+// typeFields returns the exported fields of the struct type t that are not skipped by their tags.
+func typeFields(t reflect.Type) ([]structField, error) {
+	fields := make([]structField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+
+		tag, err := parseTag(sf.Tag.Get("mtg"), sf.Type)
+		if err != nil {
+			return nil, fmt.Errorf("%w on %s.%s: %v", ErrInvalidTag, t, sf.Name, err)
+		}
+
+		if tag.skip {
+			continue
+		}
+
+		fields = append(fields, structField{
+			name:  sf.Name,
+			index: i,
+			tag:   tag,
+		})
+	}
+
+	return fields, nil
+}
+
+// indirect returns the element type of t if t is a pointer.
+func indirect(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Pointer {
+		return t.Elem()
+	}
+
+	return t
+}
+
+// isZeroer is implemented by types that decide for themselves whether they are zero.
+type isZeroer interface {
+	IsZero() bool
+}
+
+var isZeroerType = reflect.TypeOf((*isZeroer)(nil)).Elem()
+
+// zeroChecker returns a function reporting whether a value of type t is the zero
+// value of its type. Types with an IsZero method, such as decimal.Decimal and
+// time.Time, decide for themselves.
+func zeroChecker(t reflect.Type) func(reflect.Value) bool {
+	if !t.Implements(isZeroerType) {
+		return reflect.Value.IsZero
+	}
+
+	return func(val reflect.Value) bool {
+		if val.CanAddr() {
+			return val.Addr().Interface().(isZeroer).IsZero()
+		}
+
+		return val.Interface().(isZeroer).IsZero()
+	}
+}
+
+// isIntKind reports whether k is a signed or unsigned integer kind.
+func isIntKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+
+	return false
+}
+
+// setInt sets the integer value dst to the integer value src. It returns an
+// error if src does not fit in dst.
+func setInt(dst, src reflect.Value) error {
+	switch src.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i := src.Int()
+		switch dst.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if dst.OverflowInt(i) {
+				return fmt.Errorf("%w: value %d overflows %s", ErrOverflow, i, dst.Type())
+			}
+
+			dst.SetInt(i)
+			return nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if i < 0 || dst.OverflowUint(uint64(i)) {
+				return fmt.Errorf("%w: value %d overflows %s", ErrOverflow, i, dst.Type())
+			}
+
+			dst.SetUint(uint64(i))
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u := src.Uint()
+		switch dst.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if u > math.MaxInt64 || dst.OverflowInt(int64(u)) {
+				return fmt.Errorf("%w: value %d overflows %s", ErrOverflow, u, dst.Type())
+			}
+
+			dst.SetInt(int64(u))
+			return nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if dst.OverflowUint(u) {
+				return fmt.Errorf("%w: value %d overflows %s", ErrOverflow, u, dst.Type())
+			}
+
+			dst.SetUint(u)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: cannot convert %s to %s", ErrUnsupportedType, src.Type(), dst.Type())
+}
@@ -0,0 +1,226 @@
+package mtgpack
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Span is a value read by a Decoder with a Trace.
+type Span struct {
+	Offset int64       // offset of the first byte of the value
+	Len    int         // number of bytes of the value
+	Depth  int         // number of elements of the path
+	Path   string      // path of the value, like "Params[2].Min", empty for top level values
+	Type   string      // Go type of the value, or its encoding like "len" or "uvarint"
+	Value  interface{} // decoded value, nil for structs, slices, arrays, maps and fields
+}
+
+// Trace records a Span for every value read by a Decoder, through its Decode
+// methods, DecodeValue and the fields entered by DecodeMtg methods. It is meant
+// for debugging malformed input, with Dump.
+type Trace struct {
+	Spans []Span
+}
+
+// NewTraceDecoder returns a Decoder with the provided byte slice as its input,
+// which records the values it reads in the returned Trace.
+func NewTraceDecoder(b []byte) (*Decoder, *Trace) {
+	t := &Trace{}
+	d := NewDecoder(b)
+	d.SetTrace(t)
+	return d, t
+}
+
+// SetTrace makes the Decoder record the values it reads in t, or stop recording
+// if t is nil.
+func (d *Decoder) SetTrace(t *Trace) {
+	d.trace = t
+}
+
+// add records the value v of type typ read by d from offset. A value read
+// through nested calls, like DecodeVarint calling DecodeUvarint, is recorded
+// once, with the type and value of the outermost call.
+func (t *Trace) add(d *Decoder, offset int64, typ string, v interface{}) {
+	span := Span{
+		Offset: offset,
+		Len:    int(d.off - offset),
+		Depth:  len(d.path),
+		Type:   typ,
+		Value:  v,
+	}
+
+	if span.Len == 0 {
+		return
+	}
+
+	if n := len(t.Spans); n > 0 {
+		last := &t.Spans[n-1]
+		if last.Offset == span.Offset && last.Len == span.Len && last.Depth == span.Depth {
+			if span.Type == "" {
+				span.Type = last.Type
+			}
+
+			if span.Value == nil {
+				span.Value = last.Value
+			}
+
+			span.Path = last.Path
+			*last = span
+			return
+		}
+	}
+
+	span.Path = formatPath(d.path)
+	t.Spans = append(t.Spans, span)
+}
+
+// addValue records val read by d from offset. The values of structs, slices,
+// arrays and maps are left out, as their elements are recorded, except for
+// byte slices and arrays and the struct types registered with RegisterType.
+func (t *Trace) addValue(d *Decoder, offset int64, val reflect.Value) {
+	var v interface{}
+	switch typ := val.Type(); typ.Kind() {
+	case reflect.Struct:
+		// registered types are encoded as a whole, like time.Time
+		if _, ok := d.registry().lookup(typ); ok {
+			v = val.Interface()
+		}
+	case reflect.Slice, reflect.Array:
+		if typ.Elem().Kind() == reflect.Uint8 {
+			v = val.Interface()
+		}
+	case reflect.Map:
+	default:
+		v = val.Interface()
+	}
+
+	t.add(d, offset, val.Type().String(), v)
+}
+
+// Dump writes an annotated hexdump of the input b, which the Decoder of the
+// Trace read from, like:
+//
+//	00000000  01                  Version: uint8 = 1
+//	00000001  02                  ProtocolID: uint8 = 2
+//
+// Each value is written with its bytes, nested in the struct, slice or map it
+// belongs to. Bytes that were not read are annotated as unread.
+func (t *Trace) Dump(w io.Writer, b []byte) error {
+	spans := make([]Span, len(t.Spans))
+	copy(spans, t.Spans)
+	sort.SliceStable(spans, func(i, j int) bool {
+		x, y := spans[i], spans[j]
+		if x.Offset != y.Offset {
+			return x.Offset < y.Offset
+		}
+
+		if x.Len != y.Len {
+			return x.Len > y.Len
+		}
+
+		return x.Depth < y.Depth
+	})
+
+	dw := &dumpWriter{w: w, b: b}
+
+	// ends of the spans enclosing the current one
+	var stack []int64
+	for i, s := range spans {
+		end := s.Offset + int64(s.Len)
+		for len(stack) > 0 && stack[len(stack)-1] <= s.Offset {
+			dw.bytes(stack[len(stack)-1], len(stack), "")
+			stack = stack[:len(stack)-1]
+		}
+
+		dw.bytes(s.Offset, len(stack), "unread")
+
+		label := formatSpan(s)
+		if i+1 < len(spans) && spans[i+1].Offset < end {
+			dw.line(s.Offset, nil, len(stack), label)
+			stack = append(stack, end)
+			continue
+		}
+
+		dw.bytes(end, len(stack), label)
+	}
+
+	for len(stack) > 0 {
+		dw.bytes(stack[len(stack)-1], len(stack), "")
+		stack = stack[:len(stack)-1]
+	}
+
+	dw.bytes(int64(len(b)), 0, "unread")
+	return dw.err
+}
+
+// dumpBytesPerLine is the number of bytes written on a line by Trace.Dump.
+const dumpBytesPerLine = 16
+
+// dumpWriter writes the lines of Trace.Dump, keeping the first error.
+type dumpWriter struct {
+	w   io.Writer
+	b   []byte
+	pos int64 // offset of the first byte not written yet
+	err error
+}
+
+// bytes writes the bytes from pos to end, annotating the first line with label.
+func (dw *dumpWriter) bytes(end int64, depth int, label string) {
+	if end > int64(len(dw.b)) {
+		end = int64(len(dw.b))
+	}
+
+	for dw.pos < end {
+		n := end - dw.pos
+		if n > dumpBytesPerLine {
+			n = dumpBytesPerLine
+		}
+
+		dw.line(dw.pos, dw.b[dw.pos:dw.pos+n], depth, label)
+		dw.pos += n
+		label = ""
+	}
+}
+
+// line writes a line of the dump, with the offset, the bytes b and the label
+// indented by depth.
+func (dw *dumpWriter) line(offset int64, b []byte, depth int, label string) {
+	if dw.err != nil {
+		return
+	}
+
+	// two hex digits and a separating space per byte
+	h := fmt.Sprintf("% x", b)
+	line := fmt.Sprintf("%08x  %-*s  %s%s", offset, 3*dumpBytesPerLine-1, h, strings.Repeat("  ", depth), label)
+	_, dw.err = fmt.Fprintln(dw.w, strings.TrimRight(line, " "))
+}
+
+// formatSpan returns the annotation of a span, like "Params[2].Min: uint8 = 1".
+func formatSpan(s Span) string {
+	var sb strings.Builder
+	if s.Path != "" {
+		sb.WriteString(s.Path)
+		if s.Type != "" {
+			sb.WriteString(": ")
+		}
+	}
+
+	sb.WriteString(s.Type)
+	if s.Value != nil {
+		sb.WriteString(" = ")
+		switch v := s.Value.(type) {
+		case string:
+			sb.WriteString(fmt.Sprintf("%q", v))
+		case []byte:
+			sb.WriteString(hex.EncodeToString(v))
+		default:
+			sb.WriteString(fmt.Sprint(v))
+		}
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,110 @@
+package mtgpack
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testTraced has a field decoded by a DecodeMtg method, which names its fields.
+type testTraced struct {
+	Version uint8
+	Header  testCustomHeader
+	Legs    []testHeader
+	Memo    string
+}
+
+type testCustomHeader struct {
+	Action uint16
+	Asset  uuid.UUID
+}
+
+func (h *testCustomHeader) DecodeMtg(d *Decoder) error {
+	var err error
+
+	d.EnterField("Action")
+	if h.Action, err = d.DecodeUint16(); err != nil {
+		return err
+	}
+
+	d.Exit()
+
+	d.EnterField("Asset")
+	if h.Asset, err = d.DecodeUUID(); err != nil {
+		return err
+	}
+
+	d.Exit()
+	return nil
+}
+
+func TestTrace(t *testing.T) {
+	asset := uuid.MustParse("c6d0c728-2624-429b-8e0d-d9d19b6592fa")
+	b := []byte{1, 0, 3}
+	b = append(b, asset[:]...)
+	b = append(b, 1, 2, 0, 5, 2, 'h', 'i', 0xff)
+
+	dec, trace := NewTraceDecoder(b)
+
+	var x testTraced
+	require.NoError(t, dec.DecodeValue(&x))
+	assert.Equal(t, testTraced{
+		Version: 1,
+		Header:  testCustomHeader{Action: 3, Asset: asset},
+		Legs:    []testHeader{{Version: 2, Action: 5}},
+		Memo:    "hi",
+	}, x)
+
+	assert.Equal(t, []Span{
+		{Offset: 0, Len: 1, Depth: 1, Path: "Version", Type: "uint8", Value: uint8(1)},
+		{Offset: 1, Len: 2, Depth: 2, Path: "Header.Action", Type: "uint16", Value: uint16(3)},
+		{Offset: 3, Len: 16, Depth: 2, Path: "Header.Asset", Type: "uuid.UUID", Value: asset},
+		{Offset: 1, Len: 18, Depth: 1, Path: "Header", Type: "mtgpack.testCustomHeader"},
+		{Offset: 19, Len: 1, Depth: 1, Path: "Legs", Type: "len", Value: 1},
+		{Offset: 20, Len: 1, Depth: 3, Path: "Legs[0].Version", Type: "uint8", Value: uint8(2)},
+		{Offset: 21, Len: 2, Depth: 3, Path: "Legs[0].Action", Type: "uint16", Value: uint16(5)},
+		{Offset: 20, Len: 3, Depth: 2, Path: "Legs[0]", Type: "mtgpack.testHeader"},
+		{Offset: 19, Len: 4, Depth: 1, Path: "Legs", Type: "[]mtgpack.testHeader"},
+		{Offset: 23, Len: 1, Depth: 1, Path: "Memo", Type: "len", Value: 2},
+		{Offset: 23, Len: 3, Depth: 1, Path: "Memo", Type: "string", Value: "hi"},
+		{Offset: 0, Len: 26, Depth: 0, Type: "mtgpack.testTraced"},
+	}, trace.Spans)
+
+	var sb strings.Builder
+	require.NoError(t, trace.Dump(&sb, b))
+	assert.Equal(t, strings.Join([]string{
+		"00000000                                                   mtgpack.testTraced",
+		"00000000  01                                                 Version: uint8 = 1",
+		"00000001                                                     Header: mtgpack.testCustomHeader",
+		"00000001  00 03                                                Header.Action: uint16 = 3",
+		"00000003  c6 d0 c7 28 26 24 42 9b 8e 0d d9 d1 9b 65 92 fa      Header.Asset: uuid.UUID = c6d0c728-2624-429b-8e0d-d9d19b6592fa",
+		"00000013                                                     Legs: []mtgpack.testHeader",
+		"00000013  01                                                   Legs: len = 1",
+		"00000014                                                       Legs[0]: mtgpack.testHeader",
+		"00000014  02                                                     Legs[0].Version: uint8 = 2",
+		"00000015  00 05                                                  Legs[0].Action: uint16 = 5",
+		"00000017                                                     Memo: string = \"hi\"",
+		"00000017  02                                                   Memo: len = 2",
+		"00000018  68 69",
+		"0000001a  ff                                               unread",
+		"",
+	}, "\n"), sb.String())
+
+	t.Run("errors", func(t *testing.T) {
+		// the path of an error includes the fields entered by DecodeMtg
+		_, err := Unmarshal[testTraced](b[:10])
+		assert.ErrorIs(t, err, ErrUnexpectedEOF)
+
+		var de *DecodeError
+		require.ErrorAs(t, err, &de)
+		assert.Equal(t, "Header.Asset", de.Path)
+
+		// fields left entered by the failed DecodeMtg are discarded
+		dec := NewDecoder(b[:10])
+		assert.Error(t, dec.DecodeValue(&x))
+		assert.Empty(t, dec.path)
+	})
+}
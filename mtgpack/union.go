@@ -0,0 +1,144 @@
+package mtgpack
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// union describes the variants of an interface type registered with RegisterUnion.
+type union struct {
+	typ   reflect.Type           // the interface type
+	tags  map[reflect.Type]uint8 // discriminators of the variant types
+	types map[uint8]reflect.Type // variant types of the discriminators
+}
+
+// unions holds the registered unions, map[reflect.Type]*union.
+var unions sync.Map
+
+// RegisterUnion registers the variants of the interface type I, each with its
+// discriminator byte, for example:
+//
+//	mtgpack.RegisterUnion[Action](map[uint8]Action{1: &Swap{}, 2: &AddLiquidity{}})
+//
+// A value of type I is then encoded as the discriminator of its dynamic type,
+// followed by the dynamic value. Decoding into a value of type I reads the
+// discriminator and decodes a new value of the matching variant type. Only the
+// types of the variants matter, not their values. Registering I again replaces
+// its variants.
+//
+// RegisterUnion panics if I is not an interface type, if a variant is nil, or if
+// two discriminators have the same variant type. It is meant to be called from
+// init functions, before values of type I are encoded or decoded.
+func RegisterUnion[I any](variants map[uint8]I) {
+	t := reflect.TypeOf((*I)(nil)).Elem()
+	if t.Kind() != reflect.Interface {
+		panic(fmt.Sprintf("mtgpack: RegisterUnion of non-interface type %s", t))
+	}
+
+	u := &union{
+		typ:   t,
+		tags:  make(map[reflect.Type]uint8, len(variants)),
+		types: make(map[uint8]reflect.Type, len(variants)),
+	}
+
+	for tag, v := range variants {
+		vt := reflect.TypeOf(v)
+		if vt == nil {
+			panic(fmt.Sprintf("mtgpack: RegisterUnion of nil variant %d of %s", tag, t))
+		}
+
+		if prev, ok := u.tags[vt]; ok {
+			panic(fmt.Sprintf("mtgpack: RegisterUnion of %s as both variant %d and %d of %s", vt, prev, tag, t))
+		}
+
+		u.tags[vt] = tag
+		u.types[tag] = vt
+	}
+
+	unions.Store(t, u)
+}
+
+// EncodeUnion encodes v, a value of the interface type I registered with
+// RegisterUnion, as its discriminator followed by its dynamic value.
+func EncodeUnion[I any](e *Encoder, v I) error {
+	return EncodeValue(e, &v)
+}
+
+// DecodeUnion decodes a value of the interface type I registered with
+// RegisterUnion, encoded by EncodeUnion.
+func DecodeUnion[I any](d *Decoder) (I, error) {
+	var v I
+	if err := DecodeValue(d, &v); err != nil {
+		var zero I
+		return zero, err
+	}
+
+	return v, nil
+}
+
+// lookupUnion returns the union registered for the interface type t.
+func lookupUnion(t reflect.Type) (*union, error) {
+	u, ok := unions.Load(t)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s is not a registered union", ErrUnsupportedType, t)
+	}
+
+	return u.(*union), nil
+}
+
+// newUnionEncoder returns the encoder of values of the interface type t. The
+// union is looked up on every call, so that types may be registered after the
+// encoder is compiled.
+func newUnionEncoder(t reflect.Type) encoderFunc {
+	return func(e *Encoder, val reflect.Value) error {
+		u, err := lookupUnion(t)
+		if err != nil {
+			return err
+		}
+
+		if val.IsNil() {
+			return fmt.Errorf("nil interface: %s", t)
+		}
+
+		elem := val.Elem()
+		tag, ok := u.tags[elem.Type()]
+		if !ok {
+			return fmt.Errorf("%w: %s is not a registered variant of %s", ErrUnsupportedType, elem.Type(), t)
+		}
+
+		if err := e.EncodeUint8(tag); err != nil {
+			return err
+		}
+
+		return e.registry().typeEncoder(elem.Type())(e, elem)
+	}
+}
+
+// newUnionDecoder returns the decoder of values of the interface type t.
+func newUnionDecoder(t reflect.Type) decoderFunc {
+	return func(d *Decoder, val reflect.Value) error {
+		u, err := lookupUnion(t)
+		if err != nil {
+			return err
+		}
+
+		tag, err := d.DecodeUint8()
+		if err != nil {
+			return err
+		}
+
+		vt, ok := u.types[tag]
+		if !ok {
+			return fmt.Errorf("%w: %d of %s", ErrUnknownVariant, tag, t)
+		}
+
+		v := reflect.New(vt).Elem()
+		if err := d.registry().typeDecoder(vt)(d, v); err != nil {
+			return err
+		}
+
+		val.Set(v)
+		return nil
+	}
+}
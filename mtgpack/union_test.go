@@ -0,0 +1,120 @@
+package mtgpack
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testAction interface {
+	action()
+}
+
+type testSwap struct {
+	Asset uuid.UUID
+	Route string
+}
+
+type testAddLiquidity struct {
+	Amount uint64
+}
+
+type testRemoveLiquidity uint16
+
+func (*testSwap) action()           {}
+func (*testAddLiquidity) action()   {}
+func (testRemoveLiquidity) action() {}
+
+// testUnregistered implements testAction but is not registered as a variant.
+type testUnregistered struct{}
+
+func (testUnregistered) action() {}
+
+func init() {
+	RegisterUnion[testAction](map[uint8]testAction{
+		1: &testSwap{},
+		2: &testAddLiquidity{},
+		3: testRemoveLiquidity(0),
+	})
+}
+
+func TestUnion(t *testing.T) {
+	type memo struct {
+		Version uint8
+		Action  testAction
+		Next    testAction `mtg:",optional"`
+	}
+
+	swap := &testSwap{Asset: uuid.New(), Route: "xvgf"}
+	x := memo{Version: 1, Action: swap}
+
+	b, err := Marshal(x)
+	require.NoError(t, err)
+
+	want := append([]byte{1, 1}, swap.Asset[:]...)
+	want = append(want, 4, 'x', 'v', 'g', 'f', 0)
+	assert.Equal(t, want, b)
+
+	y, err := Unmarshal[memo](b)
+	require.NoError(t, err)
+	assert.Equal(t, x, y)
+
+	x.Action, x.Next = &testAddLiquidity{Amount: 10}, testRemoveLiquidity(7)
+	b, err = Marshal(x)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{1, 2, 0, 0, 0, 0, 0, 0, 0, 10, 1, 3, 0, 7}, b)
+
+	y, err = Unmarshal[memo](b)
+	require.NoError(t, err)
+	assert.Equal(t, x, y)
+
+	t.Run("top level", func(t *testing.T) {
+		enc := NewEncoder()
+		require.NoError(t, EncodeUnion[testAction](enc, swap))
+		assert.Equal(t, want[1:len(want)-1], enc.Bytes())
+
+		got, err := DecodeUnion[testAction](NewDecoder(enc.Bytes()))
+		require.NoError(t, err)
+		assert.Equal(t, swap, got)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := Marshal(memo{})
+		assert.Error(t, err)
+
+		_, err = Marshal(memo{Action: testUnregistered{}})
+		assert.ErrorIs(t, err, ErrUnsupportedType)
+
+		_, err = Unmarshal[memo]([]byte{1, 9, 0})
+		assert.ErrorIs(t, err, ErrUnknownVariant)
+
+		var de *DecodeError
+		require.True(t, errors.As(err, &de))
+		assert.Equal(t, "Action", de.Path)
+		assert.Equal(t, int64(1), de.Offset)
+
+		type unregistered interface {
+			unregistered()
+		}
+
+		_, err = DecodeUnion[unregistered](NewDecoder([]byte{1}))
+		assert.ErrorIs(t, err, ErrUnsupportedType)
+	})
+
+	t.Run("register", func(t *testing.T) {
+		assert.Panics(t, func() {
+			RegisterUnion[testSwap](map[uint8]testSwap{1: {}})
+		})
+
+		assert.Panics(t, func() {
+			RegisterUnion[testAction](map[uint8]testAction{1: nil})
+		})
+
+		assert.Panics(t, func() {
+			RegisterUnion[testAction](map[uint8]testAction{1: &testSwap{}, 2: &testSwap{}})
+		})
+	})
+}
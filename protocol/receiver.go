@@ -1,10 +1,15 @@
 package protocol
 
 import (
+	"fmt"
+
 	"github.com/google/uuid"
 	"github.com/pandodao/mtg/mtgpack"
 )
 
+// MultisigReceiver is encoded by hand rather than by mtgpackgen: the threshold
+// follows the member count and is omitted when there are fewer than two members,
+// which `mtg` tags cannot express.
 type MultisigReceiver struct {
 	Version   uint8       `json:"version"`
 	Members   []uuid.UUID `json:"members"`
@@ -13,36 +18,89 @@ type MultisigReceiver struct {
 
 func (m *MultisigReceiver) DecodeMtg(d *mtgpack.Decoder) error {
 	var err error
+	d.EnterField("Version")
 	m.Version, err = d.DecodeUint8()
 	if err != nil {
 		return err
 	}
 
+	d.Exit()
+
+	// the member count is the length of Members
+	d.EnterField("Members")
 	count, err := d.DecodeUint8()
 	if err != nil {
 		return err
 	}
 
+	d.Exit()
+
 	if count > 1 {
+		d.EnterField("Threshold")
 		m.Threshold, err = d.DecodeUint8()
 		if err != nil {
 			return err
 		}
+
+		// a threshold no set of members can reach is rejected in strict mode
+		if d.Options().Strict && (m.Threshold == 0 || m.Threshold > count) {
+			return fmt.Errorf("%w: threshold %d of %d members", mtgpack.ErrNonCanonical, m.Threshold, count)
+		}
+
+		d.Exit()
 	} else if count == 1 {
 		m.Threshold = 1
+	} else {
+		m.Threshold = 0
 	}
 
-	m.Members = make([]uuid.UUID, int(count))
+	// see mtgpack.DecoderOptions.ReuseSlices
+	if d.Options().ReuseSlices && cap(m.Members) >= int(count) {
+		m.Members = m.Members[:count]
+	} else {
+		m.Members = make([]uuid.UUID, int(count))
+	}
+
+	d.EnterField("Members")
 	for i := range m.Members {
+		d.EnterIndex(i)
 		m.Members[i], err = d.DecodeUUID()
 		if err != nil {
 			return err
 		}
+
+		d.Exit()
 	}
 
+	d.Exit()
 	return nil
 }
 
+// SkipMtg skips an encoded MultisigReceiver, see SkipReceiver.
+func (MultisigReceiver) SkipMtg(d *mtgpack.Decoder) error {
+	return SkipReceiver(d)
+}
+
+// SkipReceiver discards an encoded MultisigReceiver without decoding its members,
+// for readers that only need the fields after it.
+func SkipReceiver(d *mtgpack.Decoder) error {
+	if err := d.Skip(1); err != nil {
+		return err
+	}
+
+	count, err := d.DecodeUint8()
+	if err != nil {
+		return err
+	}
+
+	n := int(count) * len(uuid.UUID{})
+	if count > 1 {
+		n++ // threshold
+	}
+
+	return d.Skip(n)
+}
+
 func (m MultisigReceiver) EncodeMtg(e *mtgpack.Encoder) error {
 	if err := e.EncodeUint8(m.Version); err != nil {
 		return err